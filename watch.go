@@ -2,16 +2,24 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/fsnotify/fsnotify"
+	"threechicksandawick-admin-panel/watchapi"
 )
 
 // List of directories and files to ignore completely.
@@ -23,21 +31,292 @@ var ignoreList = []string{
 	"dist",
 	"build",
 	"__pycache__",
-	"watch.go",
+	"watch*.go",
 	"go.mod",
 	"go.sum",
 	".next",
+	"watchapi",
 	"directory-trees.txt", // Don't include the output file in itself
+	indexFileName,
+	eventIDFileName,
+	treeCacheFileName,
+	stateFileName,
+	crashFileName,
+}
+
+// Editor temp, swap and lock files. They come and go on every save, so they
+// are ignored unless the config's editorIgnores replaces the list.
+var defaultEditorIgnores = []string{
+	"*.swp",
+	"*.swo",
+	"*~",
+	".#*",
+	".DS_Store",
+	"4913",      // vim's write-permission probe
+	"~$*",       // Microsoft Office lock files
+	".~lock.*#", // LibreOffice lock files
 }
 
 const configFileName = "watch-config.json"
 const outputFileName = "directory-trees.txt"
 
+// Whether stdout outputs are printed. Disabled while the TUI owns the
+// terminal.
+var printTrees = true
+
 type Config struct {
-	Directories []string `json:"directories"`
+	Directories []string     `json:"directories"` // Objects with an alias are read by UnmarshalJSON
+	Index       IndexConfig  `json:"index,omitzero"`
+	Listen      string       `json:"listen,omitempty"` // Address for the HTTP API, e.g. "localhost:8765"
+	Server      ServerConfig `json:"server,omitzero"`
+
+	Outputs []OutputConfig `json:"outputs,omitempty"`
+
+	// Print the trees to the console, whatever the outputs write to
+	// files: false drops stdout outputs, true adds one if none is listed.
+	// Unset, the console gets what the outputs say.
+	Console *bool `json:"console,omitempty"`
+
+	// How often ssh:// and docker:// roots are re-listed. Defaults to 30s.
+	RemotePollInterval Duration `json:"remotePollInterval,omitzero"`
+
+	// Regenerate on this cron schedule even when no events arrive, for
+	// filesystems that don't report changes, e.g. "*/10 * * * *".
+	Schedule Schedule `json:"schedule,omitzero"`
+
+	// When set, changes only mark the trees dirty and they are
+	// regenerated at most once per interval, e.g. "30s".
+	Interval Duration `json:"interval,omitzero"`
+
+	// How long shutting down may take to write changes that arrived just
+	// before it. Defaults to 10s.
+	ShutdownGrace Duration `json:"shutdownGrace,omitzero"`
+
+	// How long the filesystem must stay quiet after a change before the
+	// trees are regenerated, so a `git checkout` in progress is never
+	// captured half-done. Defaults to 250ms.
+	SettleTime Duration `json:"settleTime,omitzero"`
+
+	// Replaces defaultEditorIgnores; an empty list ignores no editor files.
+	EditorIgnores []string `json:"editorIgnores,omitempty"`
+
+	// Commands to run when matching files change.
+	OnChange []OnChangeRule `json:"onChange,omitempty"`
+
+	// "exclude" (default), "mark" or "show" paths marked
+	// linguist-generated in .gitattributes.
+	Generated string `json:"generated,omitempty"`
+
+	// Outputs and rules for workspaces found by --detect-workspaces.
+	Workspaces WorkspacesConfig `json:"workspaces,omitzero"`
+
+	// Options for the text rendering.
+	Render RenderConfig `json:"render,omitzero"`
+
+	// SQLite database recording every generation, e.g. "watch.db".
+	Database string `json:"database,omitempty"`
+
+	// List the most frequently changed paths in each summary.
+	Heatmap HeatmapConfig `json:"heatmap,omitzero"`
+
+	// Sensitive path segments, such as client names, and the placeholders
+	// that replace them in every output with --redact. An empty
+	// placeholder becomes "[redacted]".
+	Redact map[string]string `json:"redact,omitempty"`
+
+	// How sizes and times are shown.
+	Display FormatConfig `json:"display,omitzero"`
+
+	// Append every changed path to this JSONL file, e.g.
+	// "watch-events.jsonl", for `watch history export`.
+	EventLog string `json:"eventLog,omitempty"`
+
+	// Exclude or summarize files by their sniffed content type.
+	MimeTypes []MimeRule `json:"mimeTypes,omitempty"`
+
+	// Most entries all roots together may have in the outputs. Past it,
+	// the contents of the deepest, least recently modified directories
+	// are dropped first. Zero means no cap.
+	MaxNodes int `json:"maxNodes,omitempty"`
+
+	// Descriptions shown after entries, keyed by path relative to a root
+	// (or starting with it), e.g. "lib/shopify": "Storefront API client".
+	Notes map[string]string `json:"notes,omitempty"`
+	// Describe directories without a note by the first heading or
+	// sentence of their README.md.
+	ReadmeNotes bool `json:"readmeNotes,omitempty"`
+
+	// Labels for the paths matching each .gitignore-style pattern, e.g.
+	// {"**/*.test.tsx": "test", "app/api/**": "api"}, shown as "[test]"
+	// in the text output and listed in the JSON.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Roots shown overlaid as one tree, in addition to separately.
+	Unions []UnionConfig `json:"unions,omitempty"`
+
+	// Heap limit past which trees are generated shallow.
+	Memory MemoryConfig `json:"memory,omitzero"`
+
+	// Fallback when kqueue runs out of file descriptors.
+	Kqueue KqueueConfig `json:"kqueue,omitzero"`
+
+	// Directories configured as objects, for their alias, group and
+	// order.
+	entries map[string]directoryEntry
+}
+
+const defaultSettleTime = 250 * time.Millisecond
+
+func (c Config) settleTime() time.Duration {
+	if c.SettleTime.Duration <= 0 {
+		return defaultSettleTime
+	}
+	return c.SettleTime.Duration
+}
+
+// Duration is a time.Duration that reads and writes as a string like "30s"
+// in the config file.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// ByteSize is a size in bytes that reads from the config file either as a
+// plain number or as a string with a unit, like "500MB" or "2GiB".
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var n int64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*b = ByteSize(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), 64)
+			if err != nil {
+				return fmt.Errorf("invalid size %q", s)
+			}
+			*b = ByteSize(value * float64(unit.size))
+			return nil
+		}
+	}
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = ByteSize(value)
+	return nil
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "search":
+			runSearch(os.Args[2:])
+			return
+		case "grep":
+			runGrep(os.Args[2:])
+			return
+		case "version":
+			runVersion()
+			return
+		case "self-update":
+			runSelfUpdate(os.Args[2:])
+			return
+		case "snapshot":
+			runSnapshot(os.Args[2:])
+			return
+		case "prune":
+			runPrune(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "tree":
+			runTree(os.Args[2:])
+			return
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		}
+	}
+
+	tui := flag.Bool("tui", false, "Show an interactive live tree view instead of log output")
+	dryRun := flag.Bool("dry-run", false, "Print what would be watched and written, then exit")
+	detect := flag.Bool("detect-workspaces", false, "Render each package.json, pnpm, go.work or Nx workspace as its own section")
+	flag.BoolVar(&plainOutput, "plain", false, "Plain output: no color, ASCII connectors and no build header")
+	resume := flag.Bool("resume", false, "Start from the trees saved on the last shutdown instead of walking every root")
+	flag.BoolVar(&verbose, "verbose", false, "Log every event, the ignore rule it matched and whether it regenerates the trees")
+	record := flag.String("record", "", "Append every raw watcher event to this JSONL file")
+	replay := flag.String("replay", "", "Feed the events of a --record file through the pipeline instead of watching, then exit")
+	simulate := flag.String("simulate", "", "Print when generations and tasks would run for a scripted event scenario, then exit")
+	flag.BoolVar(&emitEvents, "emit-events", false, "Print each event that isn't ignored to stdout as a JSON line, instead of the trees")
+	noConsole := flag.Bool("no-console", false, "Don't print trees to the console; file and other outputs are still written")
+	logFile := flag.String("log-file", "", "Append logs to this file and show only a status line on the console")
+	redactFlag := flag.Bool("redact", false, "Replace the home directory and the configured redact segments in all output")
+	profiles := addProfileFlags(flag.CommandLine)
+	flag.Parse()
+	defer profiles.start()()
+
+	if *dryRun {
+		runDryRun()
+		return
+	}
+	if *simulate != "" {
+		runSimulate(*simulate)
+		return
+	}
+	if *logFile != "" {
+		openLogFile(*logFile, *tui)
+	}
+	if *noConsole {
+		printTrees = false
+	}
+	if emitEvents {
+		if *tui {
+			log.Fatal("--emit-events and --tui both need stdout; use one of them")
+		}
+		printTrees = false
+	}
+
 	config, err := loadConfig()
 	if err != nil {
 		log.Println("No config file found. Starting interactive setup.")
@@ -53,48 +332,155 @@ func main() {
 	if len(config.Directories) == 0 {
 		log.Fatal("No directories to watch. Please add directories to watch-config.json or run interactive setup.")
 	}
+	configureIgnores(config)
+	if errs := config.validate(); len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("Error: %v\n", err)
+		}
+		log.Fatalf("Fix the errors in %s and restart.", configFileName)
+	}
+	if *redactFlag {
+		enableRedaction(config.Redact)
+	}
+	if *detect {
+		detectAllWorkspaces(config.Directories)
+	}
+
+	live := &liveConfig{config: config}
+	gen := newGenerator(func(ctx context.Context) { generateAllTrees(ctx, live.get()) })
+
+	var ui *tea.Program
+	if *tui {
+		ui = newTUI(config.Directories, gen.generate)
+		if *logFile == "" {
+			log.SetOutput(newTUILogWriter(ui))
+			log.SetFlags(0)
+		}
+		printTrees = false
+	}
 
-	watcher, err := fsnotify.NewWatcher()
+	watcher, err := newTreeWatcher(config.Kqueue)
 	if err != nil {
 		log.Fatal("Error creating watcher:", err)
 	}
 	defer watcher.Close()
 
-	for _, dir := range config.Directories {
-		log.Printf("Adding watcher for directory: %s\n", dir)
-		err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
+	// Replaying feeds recorded events in place of the watcher's.
+	var events <-chan fsnotify.Event = watcher.Events
+	var replayed <-chan struct{}
+	repos := gitDirs(config.Directories)
+	if *replay != "" {
+		log.Printf("Replaying events from %s instead of watching\n", *replay)
+		if events, replayed, err = replayEvents(*replay); err != nil {
+			log.Fatalf("Error reading %s: %v", *replay, err)
+		}
+	} else {
+		for _, dir := range config.Directories {
+			if isRemoteRoot(dir) {
+				continue
 			}
-			if info.IsDir() {
-				for _, item := range ignoreList {
-					if info.Name() == item {
-						return filepath.SkipDir
-					}
-				}
-				return watcher.Add(path)
+			if isFileRoot(dir) {
+				log.Printf("Adding watcher for file: %s\n", dir)
+			} else {
+				log.Printf("Adding watcher for directory: %s\n", dir)
 			}
-			return nil
-		})
-		if err != nil {
-			log.Printf("Error walking directory tree for %s: %v\n", dir, err)
+			if err := watcher.AddRoot(dir); err != nil {
+				log.Printf("Error walking directory tree for %s: %v\n", dir, err)
+			}
+		}
+		for _, gitDir := range repos {
+			watcher.AddGitDir(gitDir)
+		}
+	}
+	if *record != "" {
+		if events, err = recordEvents(*record, events); err != nil {
+			log.Fatalf("Error opening %s: %v", *record, err)
 		}
 	}
 
+	startRemotePolling(config.Directories, config.RemotePollInterval.Duration, func() {
+		gen.request()
+	})
+	startSchedule(config.Schedule, func() {
+		log.Println("Scheduled regeneration...")
+		gen.request()
+	})
+
+	var idx *fileIndex
+	if config.Index.Enabled {
+		idx = newFileIndex(config.Index.Content)
+		idx.rebuild(config.Directories)
+		if err := idx.save(); err != nil {
+			log.Printf("Error writing %s: %v\n", indexFileName, err)
+		}
+	}
+
+	if config.Heatmap.Enabled {
+		if heatmap, err = loadChangeCounts(config.Heatmap); err != nil {
+			log.Printf("Error reading %s: %v\n", config.Heatmap.File, err)
+		}
+	}
+
+	if config.Database != "" {
+		if store, err = openMetadataStore(config.Database); err != nil {
+			log.Printf("Error opening %s: %v\n", config.Database, err)
+		}
+	}
+
+	if config.Listen != "" {
+		startServer(config.Listen, config.Server, idx, gen.generate)
+	}
+
+	loadState()
+	if *resume {
+		loadTreeCache(config.Directories)
+	}
 	log.Println("Performing initial directory tree generation...")
-	generateAllTrees(config.Directories)
+	gen.generate()
 
-	go func() {
+	tasks := newTaskRunner(config.OnChange)
+
+	queue := newChangeQueue()
+
+	refreshTUI := func(done <-chan struct{}) {
+		if ui != nil {
+			go func() {
+				<-done
+				ui.Send(tuiRefreshMsg{})
+			}()
+		}
+	}
+	var gate *intervalGate
+	if config.Interval.Duration > 0 {
+		gate = newIntervalGate(config.Interval.Duration, func() { refreshTUI(gen.request()) })
+	}
+	reloadOnHangup(live, watcher, *redactFlag, func() { refreshTUI(gen.supersede()) })
+
+	// Read events as they arrive and hand each settled burst to the
+	// worker below.
+	reader := newEventReader(config.settleTime(), repos, func() []string { return live.get().Directories }, tasks, queue.push)
+	reader.note = func(event fsnotify.Event, what string) {
+		tracef("%s %s: %s\n", event.Op, event.Name, what)
+	}
+	reader.accepted = func(event fsnotify.Event, root string, structural bool) {
+		recentChanges.record(event)
+		traceEvent(event, root, structural)
+		emitEvent(event, root, structural)
+	}
+	// Shutting down asks for the batch to be queued without waiting for
+	// things to settle.
+	flush := make(chan chan struct{})
+	supervise("event reader", func() {
 		for {
 			select {
-			case event, ok := <-watcher.Events:
+			case event, ok := <-events:
 				if !ok {
 					return
 				}
-				if event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
-					log.Printf("Change detected: %s. Regenerating all trees...\n", event.Name)
-					generateAllTrees(config.Directories)
-				}
+				reader.handle(event)
+			case reply := <-flush:
+				reader.flush()
+				close(reply)
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					return
@@ -102,17 +488,147 @@ func main() {
 				log.Println("Watcher error:", err)
 			}
 		}
+	})
+
+	go func() {
+		// Last known state of each repository.
+		heads := make(map[string]*watchapi.GitState)
+		for _, gitDir := range repos {
+			heads[gitDir] = readGitState(filepath.Dir(gitDir))
+		}
+		for {
+			batch := queue.next()
+			recovered("change worker", batch.describe, func() {
+				config := live.get()
+				paths := make([]string, 0, len(batch.changed))
+				for path := range batch.changed {
+					paths = append(paths, path)
+				}
+				sort.Strings(paths)
+				regenerate := batch.structural()
+
+				// A checkout or merge always regenerates, however its
+				// events were coalesced.
+				for gitDir := range batch.movedRepos {
+					state := readGitState(filepath.Dir(gitDir))
+					previous := heads[gitDir]
+					switch {
+					case state == nil || previous == nil:
+					case state.Branch != previous.Branch:
+						log.Printf("branch switched to %s\n", state.Branch)
+					case state.Commit != previous.Commit:
+						log.Printf("%s moved to %s\n", state.Branch, state.Commit)
+					}
+					heads[gitDir] = state
+					invalidateIgnoreFiles()
+				}
+
+				if config.EventLog != "" && len(paths) > 0 {
+					if err := appendEvents(config.EventLog, config.Directories, paths, time.Now()); err != nil {
+						log.Printf("Error writing %s: %v\n", config.EventLog, err)
+					}
+				}
+				if heatmap != nil && len(paths) > 0 {
+					for _, path := range paths {
+						heatmap.record(rootFor(config.Directories, path), path)
+					}
+					if err := heatmap.save(); err != nil {
+						log.Printf("Error writing %s: %v\n", config.Heatmap.File, err)
+					}
+				}
+				if idx != nil {
+					updated := false
+					for _, path := range paths {
+						if idx.update(config.Directories, path) {
+							updated = true
+						}
+					}
+					if updated {
+						if err := idx.save(); err != nil {
+							log.Printf("Error writing %s: %v\n", indexFileName, err)
+						}
+					}
+				}
+				if !regenerate {
+					tracef("%s settled without structural changes; not regenerating\n", plural(len(paths), "path"))
+					return
+				}
+				markDirty()
+				renamed := make(map[string]bool)
+				for _, pair := range batch.renames {
+					log.Printf("renamed: %s → %s\n", pair.from, pair.to)
+					renamed[pair.from], renamed[pair.to] = true, true
+				}
+				var other []string
+				for _, path := range paths {
+					if !renamed[path] {
+						other = append(other, path)
+					}
+				}
+				if gate != nil {
+					tracef("Interval mode: trees marked dirty until the next tick\n")
+					gate.mark()
+					return
+				}
+				switch len(other) {
+				case 0:
+					log.Println("Regenerating all trees...")
+				case 1:
+					log.Printf("Change detected: %s. Regenerating all trees...\n", other[0])
+				default:
+					log.Printf("%d paths changed. Regenerating all trees...\n", len(other))
+				}
+				refreshTUI(gen.supersede())
+			})
+			queue.done()
+		}
 	}()
 
+	if ui != nil {
+		if _, err := ui.Run(); err != nil {
+			log.SetOutput(os.Stderr)
+			log.Fatal("Error running TUI:", err)
+		}
+		if *logFile == "" {
+			log.SetOutput(os.Stderr)
+		}
+		shutDown(config.shutdownGrace(), nil, func() { drainChanges(flush, queue, gen) })
+		saveTreeCache()
+		return
+	}
+
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
 
 	log.Println("Watching for file changes. Press Ctrl+C to exit.")
-	<-done
+	select {
+	case <-done:
+	case <-replayed:
+	}
 	log.Println("Shutting down watcher.")
+	shutDown(config.shutdownGrace(), done, func() { drainChanges(flush, queue, gen) })
+	saveTreeCache()
+	consoleStatus.finish()
 }
 
 func loadConfig() (Config, error) {
+	config, err := readConfig()
+	setDisplay(config)
+	setNotes(config.Notes, config.ReadmeNotes)
+	setTags(config.Tags)
+	return config, err
+}
+
+// setDisplay applies the config's display format and memory limit.
+func setDisplay(config Config) {
+	settingsMu.Lock()
+	displayFormat = config.Display
+	memoryLimit = config.Memory
+	settingsMu.Unlock()
+}
+
+// readConfig decodes the config file without applying any of it.
+func readConfig() (Config, error) {
 	var config Config
 	file, err := os.Open(configFileName)
 	if err != nil {
@@ -159,77 +675,205 @@ func saveConfig(config Config) error {
 	return encoder.Encode(config)
 }
 
-func generateAllTrees(directories []string) {
-	var allTreesBuilder strings.Builder
-	for _, dir := range directories {
-		tree, err := generateSingleTree(dir)
+// generateAllTrees builds every root and writes the outputs. A canceled
+// ctx abandons the generation before anything is written.
+func generateAllTrees(ctx context.Context, config Config) {
+	seq := beginGeneration()
+	rootErrors := make(map[string]string)
+	var roots []generatedRoot
+	var perWorkspace []workspaceOutput
+	for _, dir := range config.orderedDirectories() {
+		tree := takeResumedTree(dir)
+		var err error
+		if tree == nil {
+			tree, err = buildTree(ctx, dir)
+		}
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			log.Printf("Error generating tree for %s: %v\n", dir, err)
+			rootErrors[dir] = err.Error()
 			continue
 		}
-		allTreesBuilder.WriteString(tree)
-		allTreesBuilder.WriteString("\n---\n\n") // Separator
+		if !isRemoteRoot(dir) {
+			rememberTree(dir, tree)
+		}
+		annotateNotes(dir, tree)
+		annotateTags(dir, tree)
+		workspaces := workspaceDirs[dir]
+		removeWorkspaces(tree, workspaces)
+		root := newGeneratedRoot(ctx, dir, tree)
+		root.Alias = config.alias(dir)
+		root.Group = config.group(dir)
+		roots = append(roots, root)
+
+		for _, rel := range workspaces {
+			wsDir := filepath.Join(dir, filepath.FromSlash(rel))
+			wsTree, err := buildLocalTree(ctx, wsDir)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("Error generating tree for %s: %v\n", wsDir, err)
+				rootErrors[wsDir] = err.Error()
+				continue
+			}
+			annotateNotes(wsDir, wsTree)
+			annotateTags(wsDir, wsTree)
+			opts := applyWorkspaceRules(config, rel, wsTree)
+			ws := newGeneratedRoot(ctx, wsDir, wsTree)
+			ws.Render = &opts
+			ws.Group = root.Group
+			roots = append(roots, ws)
+			perWorkspace = append(perWorkspace, workspaceOutput{rel, ws})
+		}
 	}
 
-	// Print the combined tree to the console
-	fmt.Println(allTreesBuilder.String())
-
-	// Write the combined tree to the output file
-	err := os.WriteFile(outputFileName, []byte(allTreesBuilder.String()), 0644)
-	if err != nil {
-		log.Printf("Error writing to %s: %v\n", outputFileName, err)
-	} else {
-		log.Printf("Successfully updated %s\n", outputFileName)
+	if ctx.Err() != nil {
+		return
+	}
+	// The database records the full trees; everything else gets them
+	// within the node cap.
+	recordGeneration(roots)
+	markChanges(roots)
+	roots = append(roots, unionRoots(config.Unions, roots)...)
+	roots = pruneToNodeCap(roots, config.MaxNodes)
+
+	writeOutputs(config.outputs(), config.Render, roots)
+	if treesHandler != nil {
+		doc := newTreeDocument(roots)
+		redactDocument(&doc)
+		setLatestTrees(&doc)
+		if data, err := json.MarshalIndent(doc, "", "  "); err == nil {
+			treesHandler.Update(data)
+		}
 	}
+	for _, w := range perWorkspace {
+		writeOutputs(config.Workspaces.outputsFor(w.rel), *w.root.Render, []generatedRoot{w.root})
+	}
+	finishGeneration(seq, rootErrors)
+	consoleStatus.generated(len(config.Directories))
 }
 
-func generateSingleTree(rootDir string) (string, error) {
-	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("Directory: %s\n", rootDir))
-
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+type workspaceOutput struct {
+	rel  string
+	root generatedRoot
+}
 
-		if path == rootDir {
-			return nil
+// newGeneratedRoot attaches the git state and, for local directories, the
+// summary to a built tree.
+func newGeneratedRoot(ctx context.Context, dir string, tree *treeNode) generatedRoot {
+	root := generatedRoot{Dir: dir, Tree: tree, Git: readGitState(dir)}
+	if tree.IsDir && !isRemoteRoot(dir) {
+		if overMemoryLimit() {
+			log.Printf("Memory limit %s exceeded: skipping the summary for %s\n", formatSize(int64(currentMemoryLimit().Limit)), dir)
+		} else if summary, ok := takeResumedSummary(dir); ok {
+			root.Summary = summary
+			rememberSummary(dir, summary)
+		} else if summary, err := generateSummary(ctx, dir, tree); err == nil {
+			root.Summary = summary
+			rememberSummary(dir, summary)
+		} else if ctx.Err() == nil {
+			log.Printf("Error generating summary for %s: %v\n", dir, err)
 		}
-
-		for _, item := range ignoreList {
-			if strings.Contains(path, filepath.FromSlash("/"+item)) || info.Name() == item {
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
+		if heatmap != nil {
+			root.Summary += heatmap.section(dir)
 		}
+	}
+	return root
+}
 
-		relPath, err := filepath.Rel(rootDir, path)
+// watchableDirs returns rootDir and every non-ignored directory beneath it,
+// i.e. the directories that get a watcher registered. A file root is
+// watched through its parent directory, which survives editors replacing
+// the file on save.
+func watchableDirs(rootDir string) ([]string, error) {
+	if isFileRoot(rootDir) {
+		return []string{filepath.Dir(rootDir)}, nil
+	}
+	var dirs []string
+	err := walk(rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != rootDir && isIgnored(path) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs, err
+}
 
-		depth := len(strings.Split(relPath, string(os.PathSeparator)))
-		indent := strings.Repeat("│   ", depth-1)
+// isFileRoot reports whether a configured entry points at a single file.
+func isFileRoot(dir string) bool {
+	if isRemoteRoot(dir) {
+		return false
+	}
+	info, err := fsys.Stat(dir)
+	return err == nil && !info.IsDir()
+}
 
-		parentDir := filepath.Dir(path)
-		entries, _ := os.ReadDir(parentDir)
-		isLast := info.Name() == entries[len(entries)-1].Name()
+// configureIgnores sets ignoreList to the built-in entries, the editor
+// temp file patterns and the config's own output files, and sets how
+// generated files and MIME rules are treated.
+func configureIgnores(config Config) {
+	rules := slices.Clone(builtinIgnores)
+	if config.EditorIgnores != nil {
+		rules = append(rules, config.EditorIgnores...)
+	} else {
+		rules = append(rules, defaultEditorIgnores...)
+	}
+	rules = append(rules, outputIgnores(config)...)
+	if config.Database != "" {
+		rules = append(rules, storeIgnores(config.Database)...)
+	}
+	if config.Heatmap.File != "" {
+		rules = append(rules, filepath.Base(config.Heatmap.File))
+	}
+	if config.EventLog != "" {
+		rules = append(rules, filepath.Base(config.EventLog))
+	}
 
-		prefix := "├── "
-		if isLast {
-			prefix = "└── "
-		}
+	settingsMu.Lock()
+	ignoreList = rules
+	generatedMode = config.Generated
+	mimeRules = config.MimeTypes
+	settingsMu.Unlock()
+}
 
-		builder.WriteString(fmt.Sprintf("%s%s%s\n", indent, prefix, info.Name()))
+// ignoreRules returns the ignoreList in effect.
+func ignoreRules() []string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return ignoreList
+}
 
-		return nil
-	})
+// isIgnored reports whether path matches an entry in ignoreList or is
+// excluded by a .gitignore, .ignore or .rgignore file.
+func isIgnored(path string) bool {
+	return matchIgnoreRule(path) != ""
+}
 
-	if err != nil {
-		return "", err
+// matchIgnoreRule returns the first ignoreList entry matching path, then
+// the ignore file rule excluding it, or "". Entries containing glob
+// metacharacters are matched against the base name only.
+func matchIgnoreRule(path string) string {
+	name := filepath.Base(path)
+	for _, item := range ignoreRules() {
+		if strings.ContainsAny(item, "*?[") {
+			if matched, _ := filepath.Match(item, name); matched {
+				return item
+			}
+			continue
+		}
+		if strings.Contains(path, filepath.FromSlash("/"+item)) || name == item {
+			return item
+		}
 	}
-
-	return builder.String(), nil
-}
\ No newline at end of file
+	return matchIgnoreFiles(path)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+)
+
+// directoryEntry is one configured directory: a plain path, or an object
+// giving the path, the name shown for it in headers and JSON output, and
+// where it goes in the combined output:
+//
+//	"directories": [".", {"path": "../storefront", "alias": "Storefront (Next.js)", "group": "Frontend", "order": 1}]
+//
+// Roots are presented by ascending order, then as configured, with the
+// roots of a group kept together under its header from the first of them.
+type directoryEntry struct {
+	Path  string `json:"path"`
+	Alias string `json:"alias,omitempty"`
+	Group string `json:"group,omitempty"`
+	Order int    `json:"order,omitempty"`
+}
+
+func (e directoryEntry) MarshalJSON() ([]byte, error) {
+	if e == (directoryEntry{Path: e.Path}) {
+		return json.Marshal(e.Path)
+	}
+	type plain directoryEntry
+	return json.Marshal(plain(e))
+}
+
+func (e *directoryEntry) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		*e = directoryEntry{}
+		return json.Unmarshal(b, &e.Path)
+	}
+	type plain directoryEntry
+	return json.Unmarshal(b, (*plain)(e))
+}
+
+// Config reads directories given either way into Directories, keeping
+// the other fields aside.
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type plain Config
+	var raw struct {
+		Directories []directoryEntry `json:"directories"`
+		plain
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*c = Config(raw.plain)
+	c.Directories = nil
+	c.entries = nil
+	for _, entry := range raw.Directories {
+		c.Directories = append(c.Directories, entry.Path)
+		if entry != (directoryEntry{Path: entry.Path}) {
+			if c.entries == nil {
+				c.entries = make(map[string]directoryEntry)
+			}
+			c.entries[entry.Path] = entry
+		}
+	}
+	return nil
+}
+
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	raw := struct {
+		Directories []directoryEntry `json:"directories"`
+		plain
+	}{plain: plain(c)}
+	for _, dir := range c.Directories {
+		entry := c.entries[dir]
+		entry.Path = dir
+		raw.Directories = append(raw.Directories, entry)
+	}
+	return json.Marshal(raw)
+}
+
+// alias returns the name configured for dir, or "".
+func (c Config) alias(dir string) string {
+	return c.entries[dir].Alias
+}
+
+// group returns the group configured for dir, or "".
+func (c Config) group(dir string) string {
+	return c.entries[dir].Group
+}
+
+// orderedDirectories returns the directories in the order the combined
+// output presents them.
+func (c Config) orderedDirectories() []string {
+	dirs := slices.Clone(c.Directories)
+	slices.SortStableFunc(dirs, func(a, b string) int {
+		return cmp.Compare(c.entries[a].Order, c.entries[b].Order)
+	})
+	var ordered []string
+	placed := make(map[string]bool)
+	for _, dir := range dirs {
+		group := c.group(dir)
+		if group == "" {
+			ordered = append(ordered, dir)
+			continue
+		}
+		if placed[group] {
+			continue
+		}
+		placed[group] = true
+		for _, member := range dirs {
+			if c.group(member) == group {
+				ordered = append(ordered, member)
+			}
+		}
+	}
+	return ordered
+}
+
+// title is what headers call a root: its alias, or else its directory.
+func (r generatedRoot) title() string {
+	if r.Alias != "" {
+		return r.Alias
+	}
+	return r.Dir
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Asset kinds by extension, used by the assets render option.
+var assetKindByExt = map[string]string{
+	".png":   "image",
+	".jpg":   "image",
+	".jpeg":  "image",
+	".gif":   "image",
+	".webp":  "image",
+	".avif":  "image",
+	".svg":   "image",
+	".ico":   "image",
+	".bmp":   "image",
+	".woff":  "font",
+	".woff2": "font",
+	".ttf":   "font",
+	".otf":   "font",
+	".eot":   "font",
+	".mp4":   "video",
+	".m4v":   "video",
+	".mov":   "video",
+	".webm":  "video",
+}
+
+func assetKind(name string) string {
+	return assetKindByExt[strings.ToLower(filepath.Ext(name))]
+}
+
+// assetDetails caches the dimensions or duration read from asset files,
+// keyed by path and invalidated when size or modification time change.
+var (
+	assetDetailsMu sync.Mutex
+	assetDetails   = make(map[string]assetDetail)
+)
+
+type assetDetail struct {
+	size    int64
+	modTime time.Time
+	text    string
+}
+
+// assetLabel returns the metadata shown after an asset's name, e.g.
+// "1200×800, 245.3 KB" for an image or "0:42, 3.1 MB" for a video.
+func assetLabel(path string, node *treeNode) string {
+	assetDetailsMu.Lock()
+	cached, ok := assetDetails[path]
+	assetDetailsMu.Unlock()
+	if !ok || cached.size != node.Size || !cached.modTime.Equal(node.ModTime) {
+		cached = assetDetail{size: node.Size, modTime: node.ModTime, text: readAssetDetail(path)}
+		assetDetailsMu.Lock()
+		assetDetails[path] = cached
+		assetDetailsMu.Unlock()
+	}
+	if cached.text == "" {
+		return formatSize(node.Size)
+	}
+	return cached.text + ", " + formatSize(node.Size)
+}
+
+// readAssetDetail reads image dimensions or video duration, or returns ""
+// when the file can't be read or the format isn't understood.
+func readAssetDetail(path string) string {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+		if cfg, _, err := image.DecodeConfig(f); err == nil {
+			return fmt.Sprintf("%d×%d", cfg.Width, cfg.Height)
+		}
+	case ".webp":
+		if w, h, ok := webpDimensions(f); ok {
+			return fmt.Sprintf("%d×%d", w, h)
+		}
+	case ".mp4", ".m4v", ".mov":
+		if d, ok := mp4Duration(f); ok {
+			d = d.Round(time.Second)
+			return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+		}
+	}
+	return ""
+}
+
+// webpDimensions reads the canvas size from a WebP header.
+func webpDimensions(r io.Reader) (int, int, bool) {
+	var hdr [30]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, 0, false
+	}
+	if string(hdr[0:4]) != "RIFF" || string(hdr[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	le24 := func(b []byte) int { return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 }
+	switch string(hdr[12:16]) {
+	case "VP8X":
+		return 1 + le24(hdr[24:27]), 1 + le24(hdr[27:30]), true
+	case "VP8 ":
+		return int(binary.LittleEndian.Uint16(hdr[26:28]) & 0x3fff), int(binary.LittleEndian.Uint16(hdr[28:30]) & 0x3fff), true
+	case "VP8L":
+		bits := binary.LittleEndian.Uint32(hdr[21:25])
+		return 1 + int(bits&0x3fff), 1 + int(bits>>14&0x3fff), true
+	}
+	return 0, 0, false
+}
+
+// mp4Duration reads the duration from the movie header (moov/mvhd) of an
+// MP4 or QuickTime file.
+func mp4Duration(f fs.File) (time.Duration, bool) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, false
+	}
+	r, ok := f.(io.ReaderAt)
+	if !ok {
+		return 0, false
+	}
+	moov, moovSize, ok := findBox(r, 0, info.Size(), "moov")
+	if !ok {
+		return 0, false
+	}
+	mvhd, _, ok := findBox(r, moov, moov+moovSize, "mvhd")
+	if !ok {
+		return 0, false
+	}
+	var buf [32]byte
+	if _, err := r.ReadAt(buf[:], mvhd); err != nil {
+		return 0, false
+	}
+	var timescale, duration uint64
+	if buf[0] == 1 { // Version 1: 64-bit times
+		timescale = uint64(binary.BigEndian.Uint32(buf[20:24]))
+		duration = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(buf[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+	if timescale == 0 {
+		return 0, false
+	}
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), true
+}
+
+// findBox scans the boxes between start and end for one of the given
+// type, returning the offset and size of its payload.
+func findBox(f io.ReaderAt, start, end int64, boxType string) (int64, int64, bool) {
+	var hdr [16]byte
+	for offset := start; offset+8 <= end; {
+		if _, err := f.ReadAt(hdr[:8], offset); err != nil {
+			return 0, 0, false
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[0:4]))
+		headerLen := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := f.ReadAt(hdr[8:16], offset+8); err != nil {
+				return 0, 0, false
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			headerLen = 16
+		}
+		if size < headerLen {
+			return 0, 0, false
+		}
+		if string(hdr[4:8]) == boxType {
+			return offset + headerLen, size - headerLen, true
+		}
+		offset += size
+	}
+	return 0, 0, false
+}
+
+// assetGroupLabel summarizes grouped assets, e.g.
+// "assets: 143 images, 2 fonts (45.2 MB)".
+func assetGroupLabel(assets []*treeNode) string {
+	counts := make(map[string]int)
+	var total int64
+	for _, node := range assets {
+		counts[assetKind(node.Name)]++
+		total += node.Size
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = plural(counts[kind], kind)
+	}
+	return fmt.Sprintf("assets: %s (%s)", strings.Join(parts, ", "), formatSize(total))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// eventIDFileName records where each native event stream left off, on
+// platforms whose events can be replayed after a restart (macOS).
+const eventIDFileName = ".watch-fsevents.json"
+
+// errNoNativeRecursion is returned by startNativeWatch on platforms without
+// a recursive watch API.
+var errNoNativeRecursion = errors.New("native recursive watching is not available on this platform")
+
+// treeWatcher fans events from fsnotify and any native recursive watchers
+// into a single pair of channels.
+type treeWatcher struct {
+	fsw     *fsnotify.Watcher
+	Events  chan fsnotify.Event
+	Errors  chan error
+	closers []io.Closer
+
+	// Descriptors spent on kqueue watches so far, and what to do once
+	// they run out.
+	fds    int
+	kqueue KqueueConfig
+	done   chan struct{}
+}
+
+func newTreeWatcher(kqueue KqueueConfig) (*treeWatcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &treeWatcher{
+		fsw:    fsw,
+		Events: make(chan fsnotify.Event, 256),
+		Errors: make(chan error, 16),
+		kqueue: kqueue,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case event, ok := <-fsw.Events:
+				if !ok {
+					return
+				}
+				w.Events <- event
+			case err, ok := <-fsw.Errors:
+				if !ok {
+					return
+				}
+				w.Errors <- err
+			}
+		}
+	}()
+	return w, nil
+}
+
+// AddRoot starts watching a configured local root. Directories use a
+// single native recursive watch where the platform offers one (Windows,
+// macOS) and fall back to one fsnotify watch per directory otherwise.
+func (w *treeWatcher) AddRoot(root string) error {
+	if !isFileRoot(root) {
+		closer, err := startNativeWatch(root, w.Events, w.Errors)
+		if err == nil {
+			log.Printf("Using native recursive watch for %s\n", root)
+			w.closers = append(w.closers, closer)
+			return nil
+		}
+		if !errors.Is(err, errNoNativeRecursion) {
+			log.Printf("Native recursive watch failed for %s, falling back: %v\n", root, err)
+		}
+	}
+
+	dirs, err := watchableDirs(root)
+	if !isFileRoot(root) {
+		dirs = w.budgetDirs(root, dirs)
+	}
+	for _, path := range dirs {
+		if err := w.fsw.Add(path); err != nil {
+			log.Printf("Error watching %s: %v\n", path, err)
+		}
+	}
+	return err
+}
+
+// AddGitDir watches a repository's HEAD and branch refs so checkouts and
+// merges are noticed even when .git is outside or ignored by the roots.
+func (w *treeWatcher) AddGitDir(gitDir string) {
+	for _, dir := range []string{gitDir, filepath.Join(gitDir, "refs", "heads")} {
+		if err := w.fsw.Add(dir); err != nil {
+			log.Printf("Error watching %s: %v\n", dir, err)
+		}
+	}
+}
+
+func (w *treeWatcher) Close() error {
+	close(w.done)
+	for _, c := range w.closers {
+		c.Close()
+	}
+	return w.fsw.Close()
+}
+
+// eventPath joins a name reported relative to root, as native APIs do.
+func eventPath(root, name string) string {
+	return filepath.Join(root, filepath.FromSlash(name))
+}
+
+// renamePairWindow bounds how long after a Rename event the event for the
+// new name may arrive and still be paired with it.
+const renamePairWindow = 100 * time.Millisecond
+
+type renamePair struct {
+	from, to string
+}
+
+// renameTracker correlates the two halves of a rename. fsnotify and
+// ReadDirectoryChangesW deliver the old name as Rename and the new one as
+// Create; FSEvents reports both as Rename, the new name being the one that
+// still exists. It looks names up through fsys and times them on clk.
+type renameTracker struct {
+	from  string
+	at    time.Time
+	pairs []renamePair
+}
+
+func (t *renameTracker) observe(event fsnotify.Event) {
+	_, statErr := fsys.Lstat(event.Name)
+	exists := statErr == nil
+	now := clk.Now()
+	pending := t.from != "" && now.Sub(t.at) <= renamePairWindow && event.Name != t.from
+
+	switch {
+	case pending && exists && (event.Has(fsnotify.Create) || event.Has(fsnotify.Rename)):
+		t.pairs = append(t.pairs, renamePair{from: t.from, to: event.Name})
+		t.from = ""
+	case event.Has(fsnotify.Rename) && !exists:
+		t.from, t.at = event.Name, now
+	}
+}
+
+// take returns the pairs seen since the last call.
+func (t *renameTracker) take() []renamePair {
+	pairs := t.pairs
+	t.pairs, t.from = nil, ""
+	return pairs
+}
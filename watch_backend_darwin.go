@@ -0,0 +1,182 @@
+//go:build darwin && cgo
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsevents"
+	"github.com/fsnotify/fsnotify"
+)
+
+const nativeRecursiveBackend = "FSEvents"
+
+// How long after a batch of events the stream positions are written, so a
+// crash loses at most this much of the resume point.
+const eventIDSaveDelay = time.Second
+
+type darwinWatch struct {
+	stream *fsevents.EventStream
+}
+
+func (w *darwinWatch) Close() error {
+	w.stream.Stop()
+	return eventIDs.save()
+}
+
+// streamPosition is the last FSEvents event ID delivered for a root and
+// the UUID of the volume's event database it belongs to.
+type streamPosition struct {
+	ID   uint64 `json:"id"`
+	UUID string `json:"uuid"`
+}
+
+// eventIDs remembers each root's stream position across runs, so a
+// restarted watcher replays what changed while it was down.
+var eventIDs = &streamPositions{positions: make(map[string]streamPosition)}
+
+type streamPositions struct {
+	mu        sync.Mutex
+	loaded    bool
+	positions map[string]streamPosition
+	pending   *time.Timer // Set while a save is scheduled
+}
+
+// resumeFrom returns the saved position for root, if it was recorded on
+// the same event database.
+func (p *streamPositions) resumeFrom(root, uuid string) (uint64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.loaded {
+		p.loaded = true
+		if data, err := os.ReadFile(eventIDFileName); err == nil {
+			json.Unmarshal(data, &p.positions)
+		}
+	}
+	pos, ok := p.positions[root]
+	return pos.ID, ok && pos.ID != 0 && pos.UUID == uuid
+}
+
+func (p *streamPositions) set(root string, pos streamPosition) {
+	p.mu.Lock()
+	p.positions[root] = pos
+	p.mu.Unlock()
+}
+
+// saveSoon schedules a save eventIDSaveDelay from now, unless one is
+// already scheduled.
+func (p *streamPositions) saveSoon() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending != nil {
+		return
+	}
+	p.pending = time.AfterFunc(eventIDSaveDelay, func() {
+		if err := p.save(); err != nil {
+			log.Printf("Error saving %s: %v\n", eventIDFileName, err)
+		}
+	})
+}
+
+func (p *streamPositions) save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending != nil {
+		p.pending.Stop()
+		p.pending = nil
+	}
+	data, err := json.MarshalIndent(p.positions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(eventIDFileName, data, 0644)
+}
+
+// startNativeWatch watches root and its whole subtree with one FSEvents
+// stream.
+func startNativeWatch(root string, events chan<- fsnotify.Event, errs chan<- error) (io.Closer, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	stream := &fsevents.EventStream{
+		Paths:   []string{abs},
+		Latency: 50 * time.Millisecond,
+		Flags:   fsevents.FileEvents | fsevents.WatchRoot,
+	}
+	var uuid string
+	if dev, err := fsevents.DeviceForPath(abs); err == nil {
+		uuid = fsevents.GetDeviceUUID(dev)
+	}
+	if id, ok := eventIDs.resumeFrom(abs, uuid); ok {
+		stream.Resume = true
+		stream.EventID = id
+		log.Printf("Replaying FSEvents for %s since the last run\n", root)
+	}
+	if err := stream.Start(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for batch := range stream.Events {
+			for _, ev := range batch {
+				if ev.ID != 0 {
+					eventIDs.set(abs, streamPosition{ID: ev.ID, UUID: uuid})
+				}
+				if ev.Flags&fsevents.HistoryDone != 0 {
+					continue
+				}
+				// FSEvents reports absolute paths; map them back onto the
+				// configured root so the rest of the pipeline sees the
+				// same names a directory walk produces.
+				path := ev.Path
+				if !filepath.IsAbs(path) {
+					path = "/" + path
+				}
+				rel, err := filepath.Rel(abs, path)
+				if err != nil || strings.HasPrefix(rel, "..") {
+					continue
+				}
+				name := eventPath(root, rel)
+				if ev.Flags&fsevents.MustScanSubDirs != 0 {
+					events <- fsnotify.Event{Name: root, Op: fsnotify.Create}
+					continue
+				}
+				events <- fsnotify.Event{Name: name, Op: darwinFlagsOp(ev.Flags)}
+			}
+			eventIDs.saveSoon()
+		}
+	}()
+	return &darwinWatch{stream: stream}, nil
+}
+
+func darwinFlagsOp(flags fsevents.EventFlags) fsnotify.Op {
+	var op fsnotify.Op
+	if flags&fsevents.ItemCreated != 0 {
+		op |= fsnotify.Create
+	}
+	if flags&fsevents.ItemRemoved != 0 {
+		op |= fsnotify.Remove
+	}
+	if flags&fsevents.ItemRenamed != 0 {
+		op |= fsnotify.Rename
+	}
+	if flags&(fsevents.ItemModified|fsevents.ItemInodeMetaMod) != 0 {
+		op |= fsnotify.Write
+	}
+	if op == 0 {
+		op = fsnotify.Write
+	}
+	return op
+}
@@ -0,0 +1,16 @@
+//go:build !windows && !(darwin && cgo)
+
+package main
+
+import (
+	"io"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const nativeRecursiveBackend = ""
+
+// startNativeWatch is unavailable here; roots are watched per directory.
+func startNativeWatch(root string, events chan<- fsnotify.Event, errs chan<- error) (io.Closer, error) {
+	return nil, errNoNativeRecursion
+}
@@ -0,0 +1,82 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sys/windows"
+)
+
+const nativeRecursiveBackend = "ReadDirectoryChangesW"
+
+type windowsWatch struct {
+	handle windows.Handle
+}
+
+func (w *windowsWatch) Close() error {
+	windows.CancelIoEx(w.handle, nil)
+	return windows.CloseHandle(w.handle)
+}
+
+// startNativeWatch watches root and its whole subtree with a single
+// ReadDirectoryChangesW handle.
+func startNativeWatch(root string, events chan<- fsnotify.Event, errs chan<- error) (io.Closer, error) {
+	path, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := windows.CreateFile(path,
+		windows.FILE_LIST_DIRECTORY,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	const mask = windows.FILE_NOTIFY_CHANGE_FILE_NAME | windows.FILE_NOTIFY_CHANGE_DIR_NAME |
+		windows.FILE_NOTIFY_CHANGE_LAST_WRITE | windows.FILE_NOTIFY_CHANGE_SIZE
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			var n uint32
+			err := windows.ReadDirectoryChanges(handle, &buf[0], uint32(len(buf)), true, mask, &n, nil, 0)
+			if err != nil {
+				return // Handle closed
+			}
+			if n == 0 {
+				// The kernel buffer overflowed and events were lost; report
+				// a change at the root so everything is regenerated.
+				errs <- fmt.Errorf("event buffer overflow watching %s", root)
+				events <- fsnotify.Event{Name: root, Op: fsnotify.Create}
+				continue
+			}
+			for offset := uint32(0); ; {
+				info := (*windows.FileNotifyInformation)(unsafe.Pointer(&buf[offset]))
+				name := windows.UTF16ToString(unsafe.Slice(&info.FileName, info.FileNameLength/2))
+				events <- fsnotify.Event{Name: filepath.Join(root, name), Op: windowsActionOp(info.Action)}
+				if info.NextEntryOffset == 0 {
+					break
+				}
+				offset += info.NextEntryOffset
+			}
+		}
+	}()
+	return &windowsWatch{handle: handle}, nil
+}
+
+func windowsActionOp(action uint32) fsnotify.Op {
+	switch action {
+	case windows.FILE_ACTION_ADDED, windows.FILE_ACTION_RENAMED_NEW_NAME:
+		return fsnotify.Create
+	case windows.FILE_ACTION_REMOVED:
+		return fsnotify.Remove
+	case windows.FILE_ACTION_RENAMED_OLD_NAME:
+		return fsnotify.Rename
+	}
+	return fsnotify.Write
+}
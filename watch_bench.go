@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// benchFormats are the renderers `watch bench` times by default.
+var benchFormats = []string{"text", "json", "jsonl", "csv", "tsv", "sha256", "bundle"}
+
+// benchResult is the average of one phase over the runs.
+type benchResult struct {
+	name    string
+	elapsed time.Duration
+	allocs  uint64
+	bytes   uint64
+}
+
+// measure runs fn runs times and averages its duration and allocations.
+func measure(name string, runs int, fn func()) benchResult {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for range runs {
+		fn()
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	n := uint64(runs)
+	return benchResult{
+		name:    name,
+		elapsed: elapsed / time.Duration(runs),
+		allocs:  (after.Mallocs - before.Mallocs) / n,
+		bytes:   (after.TotalAlloc - before.TotalAlloc) / n,
+	}
+}
+
+// runBench implements `watch bench`, timing the walk, the model build and
+// each renderer over the configured roots.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := fs.Int("runs", 5, "Times to repeat each phase")
+	formats := fs.String("formats", strings.Join(benchFormats, ","), "Comma-separated output formats to render")
+	profiles := addProfileFlags(fs)
+	fs.Parse(args)
+	defer profiles.start()()
+	if *runs < 1 {
+		log.Fatal("--runs must be at least 1")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Error loading %s: %v", configFileName, err)
+	}
+	configureIgnores(config)
+
+	var local []string
+	for _, dir := range config.Directories {
+		if isRemoteRoot(dir) {
+			log.Printf("Skipping remote root %s\n", dir)
+			continue
+		}
+		local = append(local, dir)
+	}
+
+	// A first untimed pass warms the page cache and the ignore file cache
+	// and provides the roots the renderers work on.
+	var roots []generatedRoot
+	for _, dir := range local {
+		tree, err := buildTree(context.Background(), dir)
+		if err != nil {
+			log.Fatalf("Error building tree for %s: %v", dir, err)
+		}
+		roots = append(roots, newGeneratedRoot(context.Background(), dir, tree))
+	}
+	files := 0
+	for _, record := range fileRecords(roots) {
+		if record.Type == "file" {
+			files++
+		}
+	}
+
+	results := []benchResult{
+		measure("walk", *runs, func() {
+			for _, dir := range local {
+				walk(dir, func(path string, info os.FileInfo, err error) error {
+					if err != nil || path == dir || !isIgnored(path) {
+						return nil
+					}
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				})
+			}
+		}),
+		measure("build", *runs, func() {
+			for _, dir := range local {
+				if tree, err := buildTree(context.Background(), dir); err == nil {
+					newGeneratedRoot(context.Background(), dir, tree)
+				}
+			}
+		}),
+	}
+	for _, format := range strings.Split(*formats, ",") {
+		format = strings.TrimSpace(format)
+		if _, err := render(format, roots, config.Render); err != nil {
+			log.Fatalf("Error rendering %s: %v", format, err)
+		}
+		results = append(results, measure("render "+format, *runs, func() {
+			render(format, roots, config.Render)
+		}))
+	}
+
+	fmt.Printf("%d roots, %d files, %d runs per phase\n\n", len(local), files, *runs)
+	fmt.Printf("%-16s %12s %12s %12s %12s\n", "phase", "time/run", "files/sec", "allocs/run", "bytes/run")
+	for _, r := range results {
+		rate := 0.0
+		if r.elapsed > 0 {
+			rate = float64(files) / r.elapsed.Seconds()
+		}
+		fmt.Printf("%-16s %12s %12.0f %12d %12s\n", r.name, r.elapsed.Round(time.Microsecond), rate, r.allocs, formatSize(int64(r.bytes)))
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Files bigger than this are listed in a bundle but not embedded.
+const maxBundleFileSize = 1 << 20
+
+// renderBundle produces the "bundle" format: the text trees followed by
+// the contents of every local file, ready to paste into an AI context.
+// Binary files are represented by a placeholder.
+func renderBundle(roots []generatedRoot, opts RenderConfig) string {
+	var builder strings.Builder
+	builder.WriteString(renderText(roots, opts))
+	for _, root := range roots {
+		// Files of a union are bundled with the roots it overlays.
+		if isRemoteRoot(root.Dir) || root.Union != nil {
+			continue
+		}
+		for _, file := range treeFiles(root.Dir, root.Tree, false) {
+			writeBundleFile(&builder, file)
+		}
+	}
+	return builder.String()
+}
+
+type bundleFile struct {
+	path      string
+	size      int64
+	generated bool   // The file or one of its directories is linguist-generated
+	mime      string // Sniffed type of a file a MIME rule summarizes
+}
+
+// treeFiles lists the files in a tree rooted at dir.
+func treeFiles(dir string, node *treeNode, generated bool) []bundleFile {
+	generated = generated || node.Generated
+	if !node.IsDir {
+		file := bundleFile{path: dir, size: node.Size, generated: generated}
+		if node.Summarized {
+			file.mime = node.MimeType
+		}
+		return []bundleFile{file}
+	}
+	var files []bundleFile
+	for _, child := range node.Children {
+		files = append(files, treeFiles(filepath.Join(dir, child.Name), child, generated)...)
+	}
+	return files
+}
+
+func writeBundleFile(builder *strings.Builder, file bundleFile) {
+	path := file.path
+	fmt.Fprintf(builder, "## %s\n\n", redactText(filepath.ToSlash(path)))
+	if file.generated {
+		fmt.Fprintf(builder, "[generated, %s]\n\n", formatSize(file.size))
+		return
+	}
+	if file.mime != "" {
+		fmt.Fprintf(builder, "[%s, %s]\n\n", file.mime, formatSize(file.size))
+		return
+	}
+	info, err := fsys.Stat(path)
+	if err != nil {
+		fmt.Fprintf(builder, "[unreadable: %s]\n\n", redactText(err.Error()))
+		return
+	}
+	if info.Size() > maxBundleFileSize {
+		fmt.Fprintf(builder, "[too large, %s]\n\n", formatSize(info.Size()))
+		return
+	}
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(builder, "[unreadable: %s]\n\n", redactText(err.Error()))
+		return
+	}
+	if isBinary(data) {
+		fmt.Fprintf(builder, "[binary, %s]\n\n", formatSize(info.Size()))
+		return
+	}
+
+	// The fence must be longer than any backtick run in the file.
+	fence := "```"
+	for bytes.Contains(data, []byte(fence)) {
+		fence += "`"
+	}
+	lang := strings.TrimPrefix(filepath.Ext(path), ".")
+	fmt.Fprintf(builder, "%s%s\n%s", fence, lang, data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		builder.WriteString("\n")
+	}
+	fmt.Fprintf(builder, "%s\n\n", fence)
+}
+
+// isBinary reports whether data looks like something other than text: it
+// contains a NUL byte near the start, or sniffs as an image, font, archive
+// or other non-text type.
+func isBinary(data []byte) bool {
+	sample := data
+	if len(sample) > 8000 {
+		sample = sample[:8000]
+	}
+	if bytes.IndexByte(sample, 0) != -1 {
+		return true
+	}
+	mime := http.DetectContentType(sample)
+	return !strings.HasPrefix(mime, "text/") && mime != "application/octet-stream"
+}
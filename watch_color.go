@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Colors of entries in console output, next to the TUI's attributes.
+const (
+	ansiDirectory = "\x1b[1;34m" // Bold blue
+	ansiSymlink   = "\x1b[36m"   // Cyan
+	ansiExec      = "\x1b[32m"   // Green
+)
+
+// Set by --plain: no color, ASCII connectors and no build header, for
+// byte-stable output in golden-file tests and diffs.
+var plainOutput bool
+
+// useColor reports whether console output should be colored. A non-empty
+// NO_COLOR environment variable turns off automatic color.
+func (opts RenderConfig) useColor() bool {
+	switch {
+	case plainOutput:
+		return false
+	case opts.Color == "always":
+		return true
+	case opts.Color == "never", os.Getenv("NO_COLOR") != "":
+		return false
+	}
+	return isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// colorize wraps an entry's rendered name in the color for its type.
+// Generated entries, shown although excluded by default, are dimmed.
+func colorize(node *treeNode, name string) string {
+	var color string
+	switch {
+	case node.Generated:
+		color = ansiDim
+	case node.Mode&os.ModeSymlink != 0:
+		color = ansiSymlink
+	case node.IsDir:
+		color = ansiDirectory
+	case node.Mode&0111 != 0:
+		color = ansiExec
+	default:
+		return name
+	}
+	return color + name + ansiReset
+}
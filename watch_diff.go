@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// snapshotEntries maps each path in a generated tree to its entry. Paths
+// are prefixed with their root unless the root is ".".
+type snapshotEntries map[string]snapshotEntry
+
+// snapshotEntry is what a snapshot records about a path. Text snapshots
+// only carry IsDir; JSON snapshots also have size and modification time.
+type snapshotEntry struct {
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// sameFile reports whether two entries look like the same file under
+// different names: a rename keeps size and modification time.
+func (e snapshotEntry) sameFile(other snapshotEntry) bool {
+	return !e.IsDir && !other.IsDir && !e.ModTime.IsZero() &&
+		e.Size == other.Size && e.ModTime.Equal(other.ModTime)
+}
+
+// Text file outputs with entries enabled are accompanied by them as
+// gzipped JSONL in a file with this suffix. The first line is an
+// entriesHeader naming the text they were written with.
+const entriesSuffix = ".jsonl.gz"
+
+type entriesHeader struct {
+	Text string `json:"text"` // Hex SHA-256 of the text file as written
+}
+
+// writeEntries writes the entries file of a text file output whose file
+// holds text.
+func (s fileSink) writeEntries(text, entries []byte) error {
+	sum := sha256.Sum256(text)
+	header, err := json.Marshal(entriesHeader{Text: hex.EncodeToString(sum[:])})
+	if err != nil {
+		return err
+	}
+	data, err := gzipBytes(slices.Concat(header, []byte("\n"), entries))
+	if err != nil {
+		return err
+	}
+	return s.perms.writeFile(s.path+entriesSuffix, data)
+}
+
+// loadSnapshot reads the snapshot name with read. A text snapshot is read
+// from its entries file when it has one written with exactly this text;
+// one copied without it, edited or restored from a backup is parsed.
+func loadSnapshot(name string, read func(string) ([]byte, error)) (snapshotEntries, error) {
+	data, err := read(name)
+	if err != nil {
+		return nil, err
+	}
+	if entries, ok := readEntries(name, data, read); ok {
+		return entries, nil
+	}
+	return parseSnapshot(data)
+}
+
+// readEntries reads the entries file of the snapshot name, reporting
+// false when there is none or it was written with a different text.
+func readEntries(name string, text []byte, read func(string) ([]byte, error)) (snapshotEntries, bool) {
+	data, err := read(name + entriesSuffix)
+	if err != nil {
+		return nil, false
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	if data, err = io.ReadAll(zr); err != nil {
+		return nil, false
+	}
+	first, records, _ := bytes.Cut(data, []byte("\n"))
+	var header entriesHeader
+	sum := sha256.Sum256(text)
+	if json.Unmarshal(first, &header) != nil || header.Text != hex.EncodeToString(sum[:]) {
+		return nil, false
+	}
+	entries, err := parseJSONLSnapshot(records)
+	return entries, err == nil
+}
+
+// runDiff implements `watch diff <a> <b>` and `watch diff --against <ref> [file]`.
+// It exits with status 1 when the trees differ, like diff(1).
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	against := fs.String("against", "", "Compare a snapshot with its committed version at this git ref")
+	fs.Parse(args)
+
+	var nameA, nameB string
+	readA := os.ReadFile
+	if *against != "" {
+		nameB = outputFileName
+		if fs.NArg() > 0 {
+			nameB = fs.Arg(0)
+		}
+		nameA = nameB
+		readA = func(name string) ([]byte, error) {
+			return exec.Command("git", "show", *against+":./"+name).Output()
+		}
+	} else {
+		if fs.NArg() != 2 {
+			log.Fatal("Usage: watch diff <snapshotA> <snapshotB> | watch diff --against <ref> [snapshot]")
+		}
+		nameA, nameB = fs.Arg(0), fs.Arg(1)
+	}
+
+	a, err := loadSnapshot(nameA, readA)
+	if err != nil {
+		if *against != "" {
+			nameA = *against + ":" + nameA
+		}
+		log.Fatalf("Error reading %s: %v", nameA, err)
+	}
+	b, err := loadSnapshot(nameB, os.ReadFile)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", nameB, err)
+	}
+
+	if printSnapshotDiff(os.Stdout, a, b) {
+		os.Exit(1)
+	}
+}
+
+// printSnapshotDiff writes renamed, moved (~), removed (-) and added (+)
+// entries and reports whether there were any. Added or removed directories
+// are listed once rather than entry by entry.
+func printSnapshotDiff(w io.Writer, a, b snapshotEntries) bool {
+	removed := topLevelOnly(difference(a, b))
+	addedAll := difference(b, a)
+
+	// A removed entry reappearing elsewhere under the same name is a move.
+	// Candidates include entries inside newly added directories, so moving
+	// src/a into a new lib/ still pairs src/a with lib/a.
+	type move struct{ from, to string }
+	var moves, renames []move
+	used := make(map[string]bool)
+	// A file that disappeared while one with the same size and mtime
+	// appeared in the same directory was renamed.
+	for _, r := range removed {
+		for _, ad := range addedAll {
+			if !used[ad] && path.Dir(r) == path.Dir(ad) && a[r].sameFile(b[ad]) {
+				renames = append(renames, move{r, ad})
+				used[r], used[ad] = true, true
+				break
+			}
+		}
+	}
+	for _, r := range removed {
+		if used[r] {
+			continue
+		}
+		for _, ad := range addedAll {
+			if !used[ad] && path.Base(r) == path.Base(ad) && a[r].IsDir == b[ad].IsDir {
+				moves = append(moves, move{r, ad})
+				used[r] = true
+				for _, inner := range addedAll {
+					if inner == ad || strings.HasPrefix(inner, ad+"/") {
+						used[inner] = true
+					}
+				}
+				break
+			}
+		}
+	}
+	var remaining []string
+	for _, ad := range addedAll {
+		if !used[ad] {
+			remaining = append(remaining, ad)
+		}
+	}
+	added := topLevelOnly(remaining)
+
+	for _, r := range renames {
+		fmt.Fprintf(w, "renamed: %s → %s\n", r.from, r.to)
+	}
+	for _, m := range moves {
+		fmt.Fprintf(w, "~ %s -> %s\n", m.from, m.to)
+	}
+	for _, p := range removed {
+		if !used[p] {
+			fmt.Fprintf(w, "- %s%s\n", p, dirSuffix(a[p].IsDir))
+		}
+	}
+	for _, p := range added {
+		fmt.Fprintf(w, "+ %s%s\n", p, dirSuffix(b[p].IsDir))
+	}
+	fmt.Fprintf(w, "%d added, %d removed, %d moved, %d renamed\n",
+		len(added), len(removed)-len(moves)-len(renames), len(moves), len(renames))
+	return len(added)+len(removed) > 0
+}
+
+func dirSuffix(isDir bool) string {
+	if isDir {
+		return "/"
+	}
+	return ""
+}
+
+// difference returns the sorted paths in a that are not in b.
+func difference(a, b snapshotEntries) []string {
+	var out []string
+	for p := range a {
+		if _, ok := b[p]; !ok {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// topLevelOnly drops paths whose parent directory is also in the sorted list.
+func topLevelOnly(paths []string) []string {
+	set := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		set[p] = true
+	}
+	var out []string
+	for _, p := range paths {
+		parentListed := false
+		for dir := path.Dir(p); dir != "." && dir != "/" && dir != p; dir = path.Dir(dir) {
+			if set[dir] {
+				parentListed = true
+				break
+			}
+		}
+		if !parentListed {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// parseSnapshot reads a text, JSON or JSONL tree, gzipped or not.
+func parseSnapshot(data []byte) (snapshotEntries, error) {
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if isJSONL(trimmed) {
+			return parseJSONLSnapshot(trimmed)
+		}
+		return parseJSONSnapshot(trimmed)
+	}
+	return parseTextSnapshot(data), nil
+}
+
+func parseJSONSnapshot(data []byte) (snapshotEntries, error) {
+	var versioned struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &versioned); err != nil {
+		return nil, err
+	}
+	if versioned.Version >= 1 {
+		return parseSchemaSnapshot(data)
+	}
+
+	// Unversioned documents from before the schema nest treeNodes.
+	var doc struct {
+		Roots []struct {
+			Directory string    `json:"directory"`
+			Tree      *treeNode `json:"tree"`
+		} `json:"roots"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	entries := make(snapshotEntries)
+	var walk func(prefix string, node *treeNode)
+	walk = func(prefix string, node *treeNode) {
+		for _, child := range node.Children {
+			p := joinSnapshotPath(prefix, child.Name)
+			entries[p] = snapshotEntry{IsDir: child.IsDir, Size: child.Size, ModTime: child.ModTime}
+			walk(p, child)
+		}
+	}
+	for _, root := range doc.Roots {
+		switch {
+		case root.Tree == nil:
+		case !root.Tree.IsDir:
+			entries[root.Directory] = snapshotEntry{Size: root.Tree.Size, ModTime: root.Tree.ModTime}
+		default:
+			walk(rootPrefix(root.Directory), root.Tree)
+		}
+	}
+	return entries, nil
+}
+
+func parseSchemaSnapshot(data []byte) (snapshotEntries, error) {
+	var doc watchapi.Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	entries := make(snapshotEntries)
+	var walk func(node *watchapi.Node)
+	walk = func(node *watchapi.Node) {
+		for _, child := range node.Children {
+			entries[child.Path] = snapshotEntry{IsDir: child.Kind == "directory", Size: child.Size, ModTime: child.ModTime}
+			walk(child)
+		}
+	}
+	for _, root := range doc.Roots {
+		switch {
+		case root.Tree == nil, root.Union != nil: // Unions repeat other roots
+		case root.Tree.Kind != "directory":
+			entries[root.Directory] = snapshotEntry{Size: root.Tree.Size, ModTime: root.Tree.ModTime}
+		default:
+			walk(root.Tree)
+		}
+	}
+	return entries, nil
+}
+
+// parseTextSnapshot reads the box-drawing format written by renderTree, in
+// the unicode or ascii style, for text snapshots without an entries
+// sidecar. An entry is a directory when the following
+// line is nested beneath it. Entries written in the relative or absolute
+// Paths mode are recognized by their parent's path leading the name.
+func parseTextSnapshot(data []byte) snapshotEntries {
+	entries := make(snapshotEntries)
+	var stack []string // Path at each depth
+	prefix := ""
+	inTree := false
+	lastPath := ""
+	lastDepth := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "File: "); ok {
+			if i := strings.LastIndex(name, " ["); i >= 0 && strings.HasSuffix(name, "]") {
+				name = name[:i] // Git state
+			}
+			if i := strings.LastIndex(name, " ("); i >= 0 {
+				name = name[:i]
+			}
+			entries[name] = snapshotEntry{}
+			inTree = false
+			continue
+		}
+		if strings.HasPrefix(line, "Directory: ") {
+			dir := strings.TrimPrefix(line, "Directory: ")
+			if i := strings.LastIndex(dir, " ["); i >= 0 && strings.HasSuffix(dir, "]") {
+				dir = dir[:i] // Git state
+			}
+			prefix = rootPrefix(dir)
+			stack = stack[:0]
+			inTree = true
+			lastPath = ""
+			continue
+		}
+		if !inTree {
+			continue
+		}
+
+		glyphs := unicodeGlyphs
+		if strings.HasPrefix(line, asciiGlyphs.indent) || strings.HasPrefix(line, asciiGlyphs.branch) || strings.HasPrefix(line, asciiGlyphs.last) {
+			glyphs = asciiGlyphs
+		}
+		depth := 1
+		rest := line
+		for strings.HasPrefix(rest, glyphs.indent) {
+			rest = strings.TrimPrefix(rest, glyphs.indent)
+			depth++
+		}
+		var name string
+		switch {
+		case strings.HasPrefix(rest, glyphs.branch):
+			name = strings.TrimPrefix(rest, glyphs.branch)
+		case strings.HasPrefix(rest, glyphs.last):
+			name = strings.TrimPrefix(rest, glyphs.last)
+		default:
+			// Blank line, summary or separator: the tree section is over.
+			inTree = false
+			continue
+		}
+
+		if lastPath != "" && depth > lastDepth {
+			entries[lastPath] = snapshotEntry{IsDir: true}
+		}
+		if depth-1 < len(stack) {
+			stack = stack[:depth-1]
+		}
+		parent := prefix
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+		name = strings.TrimPrefix(name, "+ ") // Added since the previous generation
+		name = stripIcon(name)
+		name = stripParentPath(name, prefix, parent)
+		if strings.HasPrefix(name, glyphs.ellipsis+" (") || strings.HasPrefix(name, glyphs.ellipsis+" and ") || strings.HasPrefix(name, "assets: ") || mimeGroupLine.MatchString(name) {
+			continue // Folded subtree, entries past the cap, grouped assets or MIME groups
+		}
+		if i := strings.Index(name, noteSuffix); i >= 0 {
+			name = name[:i] // Note from the config
+		}
+		name = entryTagsSuffix.ReplaceAllString(name, "") // Tags from the config
+		name = entryMetadataSuffix.ReplaceAllString(name, "")
+		name = strings.TrimSuffix(name, " (generated)")
+		if i := strings.LastIndex(name, " ("); i >= 0 && assetKind(name[:i]) != "" {
+			name = name[:i] // Asset metadata
+		}
+		isDir := false
+		if dir, ok := strings.CutSuffix(name, "/ (empty)"); ok {
+			name, isDir = dir, true
+		}
+		// Collapsed chains list several directories on one line.
+		parts := strings.Split(name, "/")
+		for _, dir := range parts[:len(parts)-1] {
+			parent = joinSnapshotPath(parent, dir)
+			entries[parent] = snapshotEntry{IsDir: true}
+		}
+		p := joinSnapshotPath(parent, parts[len(parts)-1])
+		entries[p] = snapshotEntry{IsDir: isDir}
+		stack = append(stack, p)
+		lastPath, lastDepth = p, depth
+	}
+	return entries
+}
+
+// stripParentPath removes the parent's relative or absolute path from an
+// entry's name, leaving what the default Paths mode shows.
+func stripParentPath(name, prefix, parent string) string {
+	var candidates []string
+	if abs, err := filepath.Abs(filepath.FromSlash(parent)); err == nil && parent != "" {
+		candidates = append(candidates, filepath.ToSlash(abs)+"/")
+	} else if abs, err := filepath.Abs("."); err == nil {
+		candidates = append(candidates, filepath.ToSlash(abs)+"/")
+	}
+	if rel := strings.TrimPrefix(strings.TrimPrefix(parent, prefix), "/"); rel != "" {
+		candidates = append(candidates, rel+"/")
+	}
+	for _, c := range candidates {
+		if rest, ok := strings.CutPrefix(name, c); ok && rest != "" {
+			return rest
+		}
+	}
+	return name
+}
+
+func rootPrefix(dir string) string {
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+func joinSnapshotPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "/" + name
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadSnapshotReadsMatchingEntries(t *testing.T) {
+	mtime := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tree := &treeNode{Name: "src", IsDir: true, Children: []*treeNode{
+		{Name: "a-very-long-component-name.generated.tsx", Size: 120, ModTime: mtime, Generated: true, Tags: []string{"ui"}, Note: "product card"},
+	}}
+	roots := []generatedRoot{{Dir: "src", Tree: tree}}
+	opts := RenderConfig{MaxLineWidth: 30}
+	long := "src/a-very-long-component-name.generated.tsx"
+
+	o := OutputConfig{Path: filepath.Join(t.TempDir(), "trees.txt"), Entries: true}
+	writeOutputs([]OutputConfig{o}, opts, roots)
+	forgetWrittenOutputs(t)
+
+	entries, err := loadSnapshot(o.Path, os.ReadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := snapshotEntry{Size: 120, ModTime: mtime}
+	if got, ok := entries[long]; !ok || got.Size != want.Size || !got.ModTime.Equal(want.ModTime) {
+		t.Errorf("entries = %v, want the full name with size and mtime", entries)
+	}
+
+	// An edited text no longer matches its entries, so the text is read.
+	text, err := os.ReadFile(o.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := append(text, "└── added.ts\n"...)
+	if err := os.WriteFile(o.Path, edited, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = loadSnapshot(o.Path, os.ReadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entries[long]; ok {
+		t.Errorf("entries of the edited text = %v, want them parsed from the text", entries)
+	}
+
+	// So is a text without entries.
+	if err := os.Remove(o.Path + entriesSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSnapshot(o.Path, os.ReadFile); err != nil {
+		t.Errorf("text snapshot without entries: %v", err)
+	}
+}
+
+func TestEntriesAreOptIn(t *testing.T) {
+	forgetWrittenOutputs(t)
+	o := OutputConfig{Path: filepath.Join(t.TempDir(), "trees.txt")}
+	writeOutputs([]OutputConfig{o}, RenderConfig{}, []generatedRoot{{Dir: "src", Tree: &treeNode{Name: "src", IsDir: true}}})
+	if _, err := os.Stat(o.Path + entriesSuffix); err == nil {
+		t.Errorf("wrote %s without entries enabled", o.Path+entriesSuffix)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// parseDockerRoot splits a docker://container:/path root into its parts.
+func parseDockerRoot(dir string) (container, path string) {
+	rest := strings.TrimPrefix(dir, "docker://")
+	container, path, _ = strings.Cut(rest, ":")
+	if path == "" {
+		path = "/"
+	}
+	return container, path
+}
+
+// fetchDockerListing runs the listing command inside a container through
+// the Docker Engine API exec endpoints. The daemon is reached through
+// DOCKER_HOST (unix:// or tcp://), defaulting to the local socket.
+func fetchDockerListing(dir string) ([]byte, error) {
+	container, path := parseDockerRoot(dir)
+	client, err := dockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err = dockerCall(client, "POST", "/containers/"+container+"/exec", map[string]any{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Cmd":          []string{"sh", "-c", remoteListCommand(path)},
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := dockerRequest(client, "POST", "/exec/"+created.ID+"/start", map[string]any{"Detach": false, "Tty": false})
+	if err != nil {
+		return nil, err
+	}
+	stdout, stderr, err := demuxDockerStream(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var inspect struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if err := dockerCall(client, "GET", "/exec/"+created.ID+"/json", nil, &inspect); err != nil {
+		return nil, err
+	}
+	if inspect.ExitCode != 0 {
+		return nil, fmt.Errorf("listing exited with status %d: %s", inspect.ExitCode, strings.TrimSpace(string(stderr)))
+	}
+	return stdout, nil
+}
+
+func dockerClient() (*http.Client, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultDockerHost
+	}
+	network, addr, ok := strings.Cut(host, "://")
+	if !ok || (network != "unix" && network != "tcp") {
+		return nil, fmt.Errorf("unsupported DOCKER_HOST %q (use unix:// or tcp://)", host)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return &http.Client{
+		Timeout: 2 * time.Minute,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}, nil
+}
+
+func dockerRequest(client *http.Client, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://docker"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("docker %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func dockerCall(client *http.Client, method, path string, body, out any) error {
+	resp, err := dockerRequest(client, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// demuxDockerStream splits the multiplexed stdout/stderr stream returned by
+// a non-TTY exec into its two halves.
+func demuxDockerStream(r io.Reader) (stdout, stderr []byte, err error) {
+	var outBuf, errBuf bytes.Buffer
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, nil, err
+		}
+		size := binary.BigEndian.Uint32(header[4:])
+		dst := &outBuf
+		if header[0] == 2 {
+			dst = &errBuf
+		}
+		if _, err := io.CopyN(dst, r, int64(size)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return outBuf.Bytes(), errBuf.Bytes(), nil
+}
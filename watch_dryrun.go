@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// runDryRun prints the resolved configuration, the directories that would
+// be watched, what each ignore rule excludes and where output would go,
+// without registering watchers or writing any files.
+func runDryRun() {
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Error loading %s: %v", configFileName, err)
+	}
+	configureIgnores(config)
+
+	resolved, _ := json.MarshalIndent(config, "", "  ")
+	fmt.Printf("Configuration (%s):\n%s\n\n", configFileName, resolved)
+
+	excluded := make(map[string][]string)
+	for _, dir := range config.Directories {
+		if isRemoteRoot(dir) {
+			fmt.Printf("Remote root %s would be polled\n\n", dir)
+			continue
+		}
+		dirs, err := watchableDirs(dir)
+		if err != nil {
+			fmt.Printf("Error walking %s: %v\n", dir, err)
+		}
+		if isFileRoot(dir) {
+			fmt.Printf("File %s would be watched through its parent directory:\n", dir)
+		} else if nativeRecursiveBackend != "" {
+			fmt.Printf("Watcher for %s: one recursive %s watch (%d directories)\n", dir, nativeRecursiveBackend, len(dirs))
+			dirs = nil
+		} else {
+			fmt.Printf("Watchers for %s (%d directories):\n", dir, len(dirs))
+		}
+		for _, d := range dirs {
+			fmt.Printf("  %s\n", d)
+		}
+		fmt.Println()
+
+		walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || path == dir {
+				return nil
+			}
+			if rule := matchIgnoreRule(path); rule != "" {
+				excluded[rule] = append(excluded[rule], path)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		})
+	}
+
+	// Built-in rules first, then those from ignore files.
+	builtin := ignoreRules()
+	rules := slices.Clone(builtin)
+	var fileRules []string
+	for rule := range excluded {
+		if !slices.Contains(builtin, rule) {
+			fileRules = append(fileRules, rule)
+		}
+	}
+	sort.Strings(fileRules)
+	rules = append(rules, fileRules...)
+
+	fmt.Println("Ignore rules:")
+	for _, rule := range rules {
+		paths := excluded[rule]
+		fmt.Printf("  %s (%d excluded)\n", rule, len(paths))
+		for _, p := range paths {
+			fmt.Printf("    %s\n", p)
+		}
+	}
+	fmt.Println()
+
+	for _, o := range config.outputs() {
+		sink, err := newSink(o)
+		if err != nil {
+			fmt.Printf("Invalid output: %v\n", err)
+			continue
+		}
+		switch sink := sink.(type) {
+		case fileSink:
+			fmt.Printf("%s output would be written to: %s\n", formatName(o.Format), absPath(sink.path))
+		case historySink:
+			fmt.Printf("%s output would be written to: %s\n", formatName(o.Format), absPath(sink.String()))
+		default:
+			fmt.Printf("%s output would be sent to: %s\n", formatName(o.Format), sink)
+		}
+	}
+	for _, err := range config.validate() {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if !config.Schedule.isZero() {
+		fmt.Printf("Scheduled regeneration next at: %s\n", config.Schedule.next(time.Now()).Format(time.RFC1123))
+	}
+	if config.Index.Enabled {
+		fmt.Printf("Index would be written to: %s\n", absPath(indexFileName))
+	}
+	if config.Listen != "" {
+		scheme := "HTTP"
+		if config.Server.TLS.enabled() {
+			scheme = "HTTPS"
+		}
+		fmt.Printf("%s API would listen on: %s\n", scheme, config.Listen)
+	}
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
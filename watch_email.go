@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EmailConfig configures the email sink, which mails a periodic digest of
+// structural changes instead of the trees themselves.
+type EmailConfig struct {
+	Server   string   `json:"server"`             // SMTP server as host:port
+	Username string   `json:"username,omitempty"` // PLAIN auth when set
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Subject  string   `json:"subject,omitempty"` // Defaults to "Directory tree changes"
+	Interval Duration `json:"interval,omitzero"` // Digest period, e.g. "1h". Defaults to 24h.
+}
+
+const defaultDigestInterval = 24 * time.Hour
+
+// emailDigest accumulates the changes between successive generations until
+// the next digest is due. Sinks are recreated on every generation, so
+// digests live in a registry keyed by the sink's description, and take on
+// the latest config, interval and notify settings included, each time
+// they're looked up.
+type emailDigest struct {
+	ticker *time.Ticker
+
+	mu       sync.Mutex // Guards everything below
+	config   EmailConfig
+	policy   notifyPolicy
+	previous snapshotEntries
+	changes  bytes.Buffer
+}
+
+var (
+	digestsMu sync.Mutex
+	digests   = make(map[string]*emailDigest)
+)
+
+// sendMail is smtp.SendMail, swapped out by tests.
+var sendMail = smtp.SendMail
+
+type emailSink struct {
+	config EmailConfig
+	notify NotifyConfig
+}
+
+func (s emailSink) Write(data []byte) error {
+	entries, err := parseSnapshot(data)
+	if err != nil {
+		return err
+	}
+	s.digest().record(entries)
+	return nil
+}
+
+func (s emailSink) String() string {
+	return fmt.Sprintf("email to %s via %s", strings.Join(s.config.To, ", "), s.config.Server)
+}
+
+// digest returns the sink's digest, starting its timer on first use and
+// updating its config after that.
+func (s emailSink) digest() *emailDigest {
+	digestsMu.Lock()
+	defer digestsMu.Unlock()
+	d, ok := digests[s.String()]
+	if !ok {
+		d = &emailDigest{
+			ticker: time.NewTicker(digestInterval(s.config)),
+			config: s.config,
+			policy: notifyPolicy{config: s.notify},
+		}
+		digests[s.String()] = d
+		go d.run()
+		return d
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if interval := digestInterval(s.config); interval != digestInterval(d.config) {
+		d.ticker.Reset(interval)
+	}
+	d.config = s.config
+	d.policy.config = s.notify
+	return d
+}
+
+func digestInterval(config EmailConfig) time.Duration {
+	if config.Interval.Duration > 0 {
+		return config.Interval.Duration
+	}
+	return defaultDigestInterval
+}
+
+func (d *emailDigest) record(entries snapshotEntries) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.previous != nil {
+		var diff bytes.Buffer
+		if printSnapshotDiff(&diff, d.previous, entries) {
+			fmt.Fprintf(&d.changes, "%s\n", time.Now().Format("2006-01-02 15:04:05"))
+			d.changes.Write(diff.Bytes())
+			d.changes.WriteString("\n")
+		}
+	}
+	d.previous = entries
+}
+
+func (d *emailDigest) run() {
+	for range d.ticker.C {
+		// Changes made while held still make this digest.
+		d.mu.Lock()
+		wait := d.policy.delay(time.Now())
+		d.mu.Unlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		d.flush()
+	}
+}
+
+// flush sends the changes accumulated so far, if there are any.
+func (d *emailDigest) flush() {
+	d.mu.Lock()
+	config := d.config
+	body := d.changes.String()
+	d.changes.Reset()
+	d.mu.Unlock()
+	if body == "" {
+		return
+	}
+	if err := sendDigest(config, body); err != nil {
+		log.Printf("Error sending digest to %s: %v\n", strings.Join(config.To, ", "), err)
+		return
+	}
+	d.mu.Lock()
+	d.policy.sent(time.Now())
+	d.mu.Unlock()
+	log.Printf("Sent change digest to %s\n", strings.Join(config.To, ", "))
+}
+
+// flushDigests sends every digest with changes now, rather than when its
+// interval is up, before shutting down.
+func flushDigests() {
+	digestsMu.Lock()
+	pending := make([]*emailDigest, 0, len(digests))
+	for _, d := range digests {
+		pending = append(pending, d)
+	}
+	digestsMu.Unlock()
+	for _, d := range pending {
+		d.flush()
+	}
+}
+
+func sendDigest(config EmailConfig, body string) error {
+	subject := config.Subject
+	if subject == "" {
+		subject = "Directory tree changes"
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if config.Username != "" {
+		host, _, _ := net.SplitHostPort(config.Server)
+		auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	return sendMail(config.Server, auth, config.From, config.To, []byte(msg.String()))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestTakesReloadedConfig(t *testing.T) {
+	previousDigests, previousSend := digests, sendMail
+	digests = make(map[string]*emailDigest)
+	var sent []string
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, string(msg))
+		return nil
+	}
+	t.Cleanup(func() { digests, sendMail = previousDigests, previousSend })
+
+	config := EmailConfig{Server: "mail.example.com:25", From: "watch@example.com", To: []string{"shop@example.com"}, Subject: "Old"}
+	d := emailSink{config: config}.digest()
+	t.Cleanup(d.ticker.Stop)
+	config.Subject, config.Interval = "New", Duration{time.Hour}
+	throttle := NotifyConfig{Throttle: Duration{time.Hour}}
+	if reloaded := (emailSink{config: config, notify: throttle}).digest(); reloaded != d {
+		t.Fatal("reloading the same recipients started a second digest")
+	}
+
+	d.mu.Lock()
+	d.changes.WriteString("+ src/cart.ts\n")
+	d.mu.Unlock()
+	flushDigests()
+
+	if len(sent) != 1 || !strings.Contains(sent[0], "Subject: New\r\n") {
+		t.Fatalf("sent %q, want one digest with the new subject", sent)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.policy.last.IsZero() {
+		t.Error("flushDigests didn't record the send for throttling")
+	}
+	if wait := d.policy.delay(time.Now()); wait <= 0 {
+		t.Errorf("delay right after a send = %v, want the new throttle to apply", wait)
+	}
+}
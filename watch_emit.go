@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Set by --emit-events: every event that isn't ignored is printed to
+// stdout as one JSON object per line, for use in shell pipelines.
+var emitEvents bool
+
+// emittedEvent is one line of --emit-events output.
+type emittedEvent struct {
+	Time       time.Time `json:"time"`
+	Op         string    `json:"op"` // As fsnotify prints it, e.g. "CREATE|CHMOD"
+	Path       string    `json:"path"`
+	Root       string    `json:"root"`       // The configured directory it falls under
+	Structural bool      `json:"structural"` // Whether it changes the tree, rather than only contents
+}
+
+// childStdout is where commands run by tasks and command sinks print, so
+// their output stays out of the --emit-events stream.
+func childStdout() io.Writer {
+	if emitEvents {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+func emitEvent(event fsnotify.Event, root string, structural bool) {
+	if !emitEvents {
+		return
+	}
+	data, err := json.Marshal(emittedEvent{
+		Time:       clk.Now().UTC(),
+		Op:         event.Op.String(),
+		Path:       redactText(event.Name),
+		Root:       redactText(root),
+		Structural: structural,
+	})
+	if err != nil {
+		log.Printf("Error emitting event for %s: %v\n", event.Name, err)
+		return
+	}
+	if _, err := os.Stdout.Write(append(data, '\n')); err != nil {
+		log.Printf("Error emitting event for %s: %v\n", event.Name, err)
+	}
+}
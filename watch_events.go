@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// loggedEvent is one line of the event log: a path that changed during a
+// settle cycle.
+type loggedEvent struct {
+	Time time.Time `json:"time"`
+	Root string    `json:"root"`
+	Path string    `json:"path"`
+}
+
+// appendEvents adds the paths changed in one cycle to the event log.
+func appendEvents(file string, directories, paths []string, now time.Time) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, path := range paths {
+		if err := enc.Encode(loggedEvent{Time: now.UTC(), Root: rootFor(directories, path), Path: path}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// runHistory implements `watch history export`, which turns the event log
+// into event counts per root and interval for plotting:
+//
+//	time,root,events
+//	2026-10-16T08:00:00Z,src,42
+func runHistory(args []string) {
+	if len(args) == 0 || args[0] != "export" {
+		log.Fatal("Usage: watch history export [--format csv|tsv] [--interval 1h] [--since 168h]")
+	}
+	fs := flag.NewFlagSet("history export", flag.ExitOnError)
+	format := fs.String("format", "csv", "Output format: csv or tsv")
+	interval := fs.Duration("interval", time.Hour, "Width of each time bucket")
+	since := fs.Duration("since", 0, "Only export events this recent; zero exports everything")
+	fs.Parse(args[1:])
+
+	if *interval <= 0 {
+		log.Fatal("--interval must be positive")
+	}
+	comma := ','
+	switch *format {
+	case "csv":
+	case "tsv":
+		comma = '\t'
+	default:
+		log.Fatalf("Unknown format %q", *format)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Error loading %s: %v", configFileName, err)
+	}
+	if config.EventLog == "" {
+		log.Fatalf("No event log; set eventLog in %s", configFileName)
+	}
+	f, err := os.Open(config.EventLog)
+	if err != nil {
+		log.Fatalf("Error reading event log: %v", err)
+	}
+	defer f.Close()
+
+	type bucket struct {
+		start time.Time
+		root  string
+	}
+	counts := make(map[bucket]int)
+	var cutoff time.Time
+	if *since > 0 {
+		cutoff = time.Now().Add(-*since)
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event loggedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue // A line cut short by a crash
+		}
+		if event.Time.Before(cutoff) {
+			continue
+		}
+		counts[bucket{event.Time.Truncate(*interval), event.Root}]++
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Error reading event log: %v", err)
+	}
+
+	buckets := make([]bucket, 0, len(counts))
+	for b := range counts {
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if !buckets[i].start.Equal(buckets[j].start) {
+			return buckets[i].start.Before(buckets[j].start)
+		}
+		return buckets[i].root < buckets[j].root
+	})
+
+	w := csv.NewWriter(os.Stdout)
+	w.Comma = comma
+	w.Write([]string{"time", "root", "events"})
+	for _, b := range buckets {
+		w.Write([]string{b.start.Format(time.RFC3339), b.root, strconv.Itoa(counts[b])})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatal(err)
+	}
+}
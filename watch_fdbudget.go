@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// KqueueConfig controls what happens on kqueue platforms (BSD, and macOS
+// when FSEvents isn't available) when a root has more directories than the
+// process may open descriptors for.
+type KqueueConfig struct {
+	// "poll" (default) watches as many levels as fit and polls the
+	// deeper directories for entries being added or removed; "depth"
+	// leaves the deeper directories unwatched.
+	Fallback string `json:"fallback,omitempty"`
+
+	// How often directories past the limit are polled. Defaults to 10s.
+	PollInterval Duration `json:"pollInterval,omitzero"`
+}
+
+const defaultKqueuePollInterval = 10 * time.Second
+
+// Descriptors left for output files, sockets and the HTTP server.
+const fdReserve = 128
+
+// kqueueCost estimates the descriptors fsnotify's kqueue backend opens for
+// a directory: one for the directory and one for each file in it.
+func kqueueCost(dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 1
+	}
+	cost := 1
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			cost++
+		}
+	}
+	return cost
+}
+
+// budgetDirs returns the directories of root that fit in the descriptor
+// limit, whole levels at a time from the top. The rest are polled or
+// dropped as configured, and a warning is logged when the limit is close.
+func (w *treeWatcher) budgetDirs(root string, dirs []string) []string {
+	limit, ok := fdLimit()
+	if !ok {
+		return dirs
+	}
+	budget := limit - fdReserve
+
+	depth := func(dir string) int {
+		rel, _ := filepath.Rel(root, dir)
+		if rel == "." {
+			return 0
+		}
+		return strings.Count(rel, string(filepath.Separator)) + 1
+	}
+	sort.SliceStable(dirs, func(i, j int) bool { return depth(dirs[i]) < depth(dirs[j]) })
+
+	fit := len(dirs)
+	for start := 0; start < len(dirs); {
+		end, cost := start, 0
+		for end < len(dirs) && depth(dirs[end]) == depth(dirs[start]) {
+			cost += kqueueCost(dirs[end])
+			end++
+		}
+		if w.fds+cost > budget {
+			fit = start
+			break
+		}
+		w.fds += cost
+		start = end
+	}
+
+	if fit == len(dirs) {
+		if w.fds > budget*8/10 {
+			log.Printf("Warning: kqueue watches use about %d of %d file descriptors (ulimit -n); raise the limit before adding more directories\n", w.fds, limit)
+		}
+		return dirs
+	}
+	rest := dirs[fit:]
+	if w.kqueue.Fallback == "depth" {
+		log.Printf("Warning: the file descriptor limit (%d) allows watching %s only %d levels deep; %d deeper directories are not watched. Raise ulimit -n to watch them\n", limit, root, depth(rest[0]), len(rest))
+	} else {
+		interval := w.kqueue.PollInterval.Duration
+		if interval <= 0 {
+			interval = defaultKqueuePollInterval
+		}
+		log.Printf("Warning: the file descriptor limit (%d) allows watching %s only %d levels deep; %d deeper directories are polled every %s. Raise ulimit -n to watch them\n", limit, root, depth(rest[0]), len(rest), interval)
+		w.pollDirs(rest, interval)
+	}
+	return dirs[:fit]
+}
+
+// pollDirs checks the modification times of dirs every interval and
+// reports a directory whose entries changed as created, which regenerates
+// its root. Edits to existing files aren't seen.
+func (w *treeWatcher) pollDirs(dirs []string, interval time.Duration) {
+	modTimes := make(map[string]time.Time, len(dirs))
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil {
+			modTimes[dir] = info.ModTime()
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+			for dir, previous := range modTimes {
+				info, err := os.Stat(dir)
+				if err != nil {
+					delete(modTimes, dir)
+					w.Events <- fsnotify.Event{Name: dir, Op: fsnotify.Remove}
+					continue
+				}
+				if !info.ModTime().Equal(previous) {
+					modTimes[dir] = info.ModTime()
+					w.Events <- fsnotify.Event{Name: dir, Op: fsnotify.Create}
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,18 @@
+//go:build darwin || freebsd || openbsd || netbsd || dragonfly
+
+package main
+
+import "syscall"
+
+// fdLimit returns the soft limit on open descriptors, which bounds how
+// many paths fsnotify's kqueue backend can watch.
+func fdLimit() (int, bool) {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0, false
+	}
+	if uint64(rl.Cur) > 1<<24 {
+		return 0, false
+	}
+	return int(rl.Cur), true
+}
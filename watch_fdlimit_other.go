@@ -0,0 +1,9 @@
+//go:build !(darwin || freebsd || openbsd || netbsd || dragonfly)
+
+package main
+
+// fdLimit reports no limit: inotify and ReadDirectoryChangesW don't hold
+// a descriptor per watched path.
+func fdLimit() (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// How long a write to a FIFO may wait on a reader that stopped reading
+// before the generation moves on without it.
+const fifoWriteTimeout = 5 * time.Second
+
+// errNoReader means nothing has a FIFO open for reading, so the output
+// is skipped rather than waited for.
+var errNoReader = errors.New("no reader")
+
+// FIFOs stay open between generations, so a reader sees one stream of
+// trees rather than an end of file after each.
+var (
+	fifosMu sync.Mutex
+	fifos   = make(map[string]*os.File)
+)
+
+// fifoSink streams output into a named pipe, created if missing.
+type fifoSink struct {
+	path  string
+	perms filePerms
+}
+
+func (s fifoSink) Write(data []byte) error {
+	fifosMu.Lock()
+	defer fifosMu.Unlock()
+	f := fifos[s.path]
+	if f == nil {
+		var err error
+		if f, err = openFIFO(s.path, s.perms); err != nil {
+			return err
+		}
+		fifos[s.path] = f
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	f.SetWriteDeadline(time.Now().Add(fifoWriteTimeout))
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		delete(fifos, s.path)
+		if isBrokenPipe(err) {
+			return errNoReader
+		}
+		return err
+	}
+	return nil
+}
+
+func (s fifoSink) String() string { return s.path }
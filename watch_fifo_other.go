@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// openFIFO fails: named pipes here aren't files.
+func openFIFO(path string, perms filePerms) (*os.File, error) {
+	return nil, errors.New("fifo outputs need a Unix system")
+}
+
+func isBrokenPipe(err error) bool {
+	return false
+}
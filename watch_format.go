@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// FormatConfig chooses how sizes and times are shown in the text and
+// Markdown outputs. JSON keeps bytes and RFC 3339 times and, when either
+// is set, adds the formatted values as "display".
+type FormatConfig struct {
+	// "datetime" (default, "2026-10-16 08:00:00"), "rfc3339", "relative"
+	// ("2h ago") or a Go time layout.
+	Time string `json:"time,omitempty"`
+
+	// "binary" (default, 1024 bytes per KB) or "si" (1000 bytes per kB).
+	Size string `json:"size,omitempty"`
+}
+
+// displayFormat is the configured format, set when the config is loaded.
+var displayFormat FormatConfig
+
+// currentFormat returns the displayFormat in effect.
+func currentFormat() FormatConfig {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return displayFormat
+}
+
+// formatTime renders a modification time in the configured layout.
+func formatTime(t time.Time) string {
+	layout := currentFormat().Time
+	switch layout {
+	case "", "datetime":
+		return t.Format("2006-01-02 15:04:05")
+	case "rfc3339":
+		return t.Format(time.RFC3339)
+	case "relative":
+		return relativeTime(time.Since(t))
+	}
+	return t.Format(layout)
+}
+
+// relativeTime renders an age such as "just now", "5m ago" or "3d ago".
+func relativeTime(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age/time.Minute))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(age/time.Hour))
+	case age < 365*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(age/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%dy ago", int(age/(365*24*time.Hour)))
+}
+
+// formatSize renders a byte count for humans, e.g. "2.3 KB".
+func formatSize(size int64) string {
+	unit, prefixes := int64(1024), "KMGTPE"
+	if currentFormat().Size == "si" {
+		unit, prefixes = 1000, "kMGTPE"
+	}
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := unit, 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), prefixes[exp])
+}
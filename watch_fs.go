@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileSystem is what the walker, the ignore rules and the renderers read
+// through. Names are OS paths, relative to the working directory or
+// absolute, as everywhere else.
+type fileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	ReadFile(name string) ([]byte, error)
+	Open(name string) (fs.File, error)
+}
+
+// fsys is the real filesystem unless replaced, e.g. by mountFS over an
+// fstest.MapFS to run the pipeline against an in-memory fixture.
+var fsys fileSystem = osFS{}
+
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (osFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+
+// mountedFS serves an io/fs tree as if it were mounted at dir. Paths
+// outside dir don't exist.
+type mountedFS struct {
+	fsys fs.FS
+	dir  string
+}
+
+// mountFS returns a fileSystem showing fsys at dir, which defaults to the
+// working directory.
+func mountFS(fsys fs.FS, dir string) (fileSystem, error) {
+	if dir == "" {
+		dir = "."
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return mountedFS{fsys: fsys, dir: abs}, nil
+}
+
+// resolve maps an OS path onto the slash-separated name fs.FS expects.
+func (m mountedFS) resolve(op, name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	rel, err := filepath.Rel(m.dir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func (m mountedFS) Stat(name string) (fs.FileInfo, error) {
+	rel, err := m.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(m.fsys, rel)
+}
+
+func (m mountedFS) Lstat(name string) (fs.FileInfo, error) {
+	rel, err := m.resolve("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Lstat(m.fsys, rel)
+}
+
+func (m mountedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	rel, err := m.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(m.fsys, rel)
+}
+
+func (m mountedFS) ReadFile(name string) ([]byte, error) {
+	rel, err := m.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(m.fsys, rel)
+}
+
+func (m mountedFS) Open(name string) (fs.File, error) {
+	rel, err := m.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return m.fsys.Open(rel)
+}
+
+// walk is filepath.Walk over fsys: lexical order, symlinks not followed,
+// and the same SkipDir and SkipAll handling.
+func walk(root string, fn filepath.WalkFunc) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkPath(root, info, fn)
+	}
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walkPath(path string, info fs.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+	entries, err := fsys.ReadDir(path)
+	err1 := fn(path, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+	for _, entry := range entries {
+		name := filepath.Join(path, entry.Name())
+		info, err := fsys.Lstat(name)
+		if err != nil {
+			if err := fn(name, info, err); err != nil && !errors.Is(err, filepath.SkipDir) {
+				return err
+			}
+			continue
+		}
+		if err := walkPath(name, info, fn); err != nil {
+			if !info.IsDir() || !errors.Is(err, filepath.SkipDir) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// glob is filepath.Glob over fsys.
+func glob(pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if !hasGlobMeta(pattern) {
+		if _, err := fsys.Lstat(pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+	dir, file := filepath.Split(pattern)
+	switch dir {
+	case "":
+		dir = "."
+	case string(filepath.Separator):
+	default:
+		dir = dir[:len(dir)-1]
+	}
+	if !hasGlobMeta(dir) {
+		return globDir(dir, file), nil
+	}
+	dirs, err := glob(dir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, d := range dirs {
+		matches = append(matches, globDir(d, file)...)
+	}
+	return matches, nil
+}
+
+// globDir returns the entries of dir whose names match pattern.
+func globDir(dir, pattern string) []string {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var matches []string
+	for _, entry := range entries {
+		if ok, _ := filepath.Match(pattern, entry.Name()); ok {
+			matches = append(matches, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return matches
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
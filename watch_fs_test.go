@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWatchableDirsReadsFixture(t *testing.T) {
+	useFixture(t, fixture)
+	configureIgnores(Config{})
+
+	dirs, err := watchableDirs("fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, dir := range []string{"", "src", "src/app", "src/components", "src/lib", "src/lib/__tests__"} {
+		want = append(want, filepath.Join("fixture", filepath.FromSlash(dir)))
+	}
+	if !slices.Equal(dirs, want) {
+		t.Errorf("watchableDirs = %q, want %q", dirs, want)
+	}
+}
+
+func TestMountFSHidesOutside(t *testing.T) {
+	useFixture(t, fixture)
+	if _, err := fsys.Stat(filepath.Join("..", "fixture")); err == nil {
+		t.Error("a path outside the mount was found")
+	}
+	if _, err := fsys.Stat(filepath.Join("fixture", "README.md")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDetectWorkspacesReadsFixture(t *testing.T) {
+	mono := fstest.MapFS{
+		"mono/package.json":             {Data: []byte(`{"workspaces": ["apps/*"]}`)},
+		"mono/pnpm-workspace.yaml":      {Data: []byte("packages:\n  - 'packages/*'\n")},
+		"mono/go.work":                  {Data: []byte("go 1.25\n\nuse ./services/api\n")},
+		"mono/apps/admin/package.json":  {Data: []byte(`{"name": "admin"}`)},
+		"mono/apps/docs/README.md":      {Data: []byte("no package.json\n")},
+		"mono/packages/ui/package.json": {Data: []byte(`{"name": "ui"}`)},
+		"mono/services/api/go.mod":      {Data: []byte("module api\n")},
+		"mono/tools/gen/project.json":   {Data: []byte(`{}`)},
+	}
+	useFixture(t, mono)
+	configureIgnores(Config{})
+
+	want := []string{"apps/admin", "packages/ui", "services/api", "tools/gen"}
+	if got := detectWorkspaces("mono"); !slices.Equal(got, want) {
+		t.Errorf("detectWorkspaces = %q, want %q", got, want)
+	}
+}
+
+func TestGlobOverFsys(t *testing.T) {
+	useFixture(t, fixture)
+	got, err := glob(filepath.Join("fixture", "src", "*", "*.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join("fixture", "src", "lib", "utils.ts")}
+	if !slices.Equal(got, want) {
+		t.Errorf("glob = %q, want %q", got, want)
+	}
+}
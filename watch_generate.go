@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// generator runs generations one at a time on its own goroutine, so
+// events, remote polls, the API and the TUI never start overlapping runs
+// that interleave their output and race on the output files. Requests
+// made while a generation is running are coalesced into one follow-up.
+type generator struct {
+	run  func(ctx context.Context)
+	wake chan struct{}
+
+	mu     sync.Mutex
+	next   chan struct{}      // Closed when the pending generation finishes; nil if none is pending
+	cancel context.CancelFunc // Cancels the running generation
+}
+
+func newGenerator(run func(ctx context.Context)) *generator {
+	g := &generator{run: run, wake: make(chan struct{}, 1)}
+	go g.loop()
+	return g
+}
+
+// request schedules a generation unless one is already pending and
+// returns a channel closed once it has finished.
+func (g *generator) request() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.next == nil {
+		g.next = make(chan struct{})
+		g.wake <- struct{}{}
+	}
+	return g.next
+}
+
+// supersede is request for a change that makes the running generation
+// stale: it is canceled rather than finished, and those waiting for it
+// wait for the new one instead.
+func (g *generator) supersede() <-chan struct{} {
+	done := g.request()
+	g.mu.Lock()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	g.mu.Unlock()
+	return done
+}
+
+// generate requests a generation and waits for it.
+func (g *generator) generate() {
+	<-g.request()
+}
+
+func (g *generator) loop() {
+	var waiting []chan struct{}
+	for range g.wake {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.mu.Lock()
+		waiting = append(waiting, g.next)
+		g.next = nil
+		g.cancel = cancel
+		g.mu.Unlock()
+
+		// A panic ends the run as if it had finished, so nobody waits
+		// for it forever.
+		recovered("generation", nil, func() { g.run(ctx) })
+
+		g.mu.Lock()
+		g.cancel = nil
+		g.mu.Unlock()
+		if ctx.Err() == nil {
+			for _, done := range waiting {
+				close(done)
+			}
+			waiting = nil
+		}
+		cancel()
+	}
+}
+
+// intervalGate turns changes into at most one generation per interval, for
+// the interval option: changes only mark the trees dirty, and a ticker
+// regenerates them if they are. Consumers that poll the outputs on their
+// own clock gain nothing from a regeneration per burst of events.
+type intervalGate struct {
+	interval   time.Duration
+	regenerate func()
+	timer      clockTimer
+
+	mu    sync.Mutex
+	dirty bool
+}
+
+// newIntervalGate starts the ticker, calling regenerate on each tick that
+// finds the trees dirty.
+func newIntervalGate(interval time.Duration, regenerate func()) *intervalGate {
+	gate := &intervalGate{interval: interval, regenerate: regenerate}
+	gate.timer = clk.AfterFunc(interval, gate.tick)
+	return gate
+}
+
+func (g *intervalGate) tick() {
+	g.mu.Lock()
+	dirty := g.dirty
+	g.dirty = false
+	g.mu.Unlock()
+	if dirty {
+		log.Println("Trees changed during the interval. Regenerating all trees...")
+		g.regenerate()
+	}
+	g.timer.Reset(g.interval)
+}
+
+// mark records that the trees need regenerating at the next tick.
+func (g *intervalGate) mark() {
+	g.mu.Lock()
+	g.dirty = true
+	g.mu.Unlock()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// readGitState returns the branch, HEAD and dirty state of the repository
+// containing dir, or nil when dir isn't in one.
+func readGitState(dir string) *watchapi.GitState {
+	if isRemoteRoot(dir) {
+		return nil
+	}
+	if isFileRoot(dir) {
+		dir = filepath.Dir(dir)
+	}
+	if gitTopLevel(dir) == "" {
+		return nil
+	}
+	cmd := exec.Command("git", "status", "--porcelain=v2", "--branch")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	state := &watchapi.GitState{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "# branch.oid "):
+			state.Commit = strings.TrimPrefix(line, "# branch.oid ")
+			if len(state.Commit) > 7 && state.Commit != "(initial)" {
+				state.Commit = state.Commit[:7]
+			}
+		case strings.HasPrefix(line, "# branch.head "):
+			state.Branch = strings.TrimPrefix(line, "# branch.head ")
+			if state.Branch == "(detached)" {
+				state.Branch = "HEAD"
+			}
+		case !strings.HasPrefix(line, "#"):
+			state.Dirty = true
+		}
+	}
+	return state
+}
+
+// gitHeaderSuffix is appended to a root's header line.
+func gitHeaderSuffix(g *watchapi.GitState) string {
+	if g == nil {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", g)
+}
+
+// gitDirs returns the .git directories of the repositories containing the
+// local roots.
+func gitDirs(dirs []string) []string {
+	var out []string
+	for _, dir := range dirs {
+		if isRemoteRoot(dir) {
+			continue
+		}
+		top := gitTopLevel(dir)
+		if top == "" {
+			continue
+		}
+		gitDir := filepath.Join(top, ".git")
+		if info, err := os.Stat(gitDir); err != nil || !info.IsDir() {
+			continue // Worktrees and submodules use a .git file
+		}
+		if !slices.Contains(out, gitDir) {
+			out = append(out, gitDir)
+		}
+	}
+	return out
+}
+
+// gitRefChange returns the .git directory path belongs to when it is HEAD,
+// ORIG_HEAD (written by merges) or a branch ref, or "".
+func gitRefChange(gitDirs []string, path string) string {
+	for _, gitDir := range gitDirs {
+		rel, err := filepath.Rel(gitDir, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "HEAD" || rel == "ORIG_HEAD" || strings.HasPrefix(rel, "refs/heads/") && !strings.HasSuffix(rel, ".lock") {
+			return gitDir
+		}
+	}
+	return ""
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// How paths marked linguist-generated in .gitattributes are treated:
+// "exclude" (the default) leaves them out of trees and bundles, "mark"
+// labels them "(generated)" and "show" ignores the attribute. Set from the
+// config at startup.
+var generatedMode string
+
+// currentGeneratedMode returns the generatedMode in effect.
+func currentGeneratedMode() string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return generatedMode
+}
+
+// gitPattern is one compiled .gitignore-style pattern.
+type gitPattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// compileGitPattern converts a .gitignore/.gitattributes pattern into a
+// regexp matching slash-separated paths relative to the file's directory.
+// Patterns without a slash match at any depth; "**" spans directories.
+func compileGitPattern(pattern string) (gitPattern, bool) {
+	var p gitPattern
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return p, false
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			expr.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return p, false
+	}
+	p.re = re
+	return p, true
+}
+
+func (p gitPattern) match(rel string, isDir bool) bool {
+	return (!p.dirOnly || isDir) && p.re.MatchString(rel)
+}
+
+type attributeRule struct {
+	pattern   gitPattern
+	generated bool
+}
+
+// gitAttributes answers whether paths are linguist-generated, reading the
+// .gitattributes files from the repository top down to each path's
+// directory. Files are loaded once per instance, so build one per walk.
+type gitAttributes struct {
+	top   string // Repository top level, or "" outside a repository
+	rules map[string][]attributeRule
+}
+
+func newGitAttributes(rootDir string) *gitAttributes {
+	return &gitAttributes{top: gitTopLevel(rootDir), rules: make(map[string][]attributeRule)}
+}
+
+// gitTopLevel returns the closest directory at or above dir containing
+// .git.
+func gitTopLevel(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := fsys.Stat(filepath.Join(abs, ".git")); err == nil {
+			return abs
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return ""
+		}
+		abs = parent
+	}
+}
+
+// generated reports whether path is marked linguist-generated. Later
+// files and later lines take precedence, as in git.
+func (a *gitAttributes) generated(path string, isDir bool) bool {
+	if a.top == "" {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(a.top, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	result := false
+	dir := a.top
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		relToDir := strings.Join(parts[i:], "/")
+		for _, rule := range a.load(dir) {
+			if rule.pattern.match(relToDir, isDir) {
+				result = rule.generated
+			}
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	return result
+}
+
+func (a *gitAttributes) load(dir string) []attributeRule {
+	if rules, ok := a.rules[dir]; ok {
+		return rules
+	}
+	var rules []attributeRule
+	if f, err := fsys.Open(filepath.Join(dir, ".gitattributes")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			pattern, ok := compileGitPattern(fields[0])
+			if !ok || pattern.negate {
+				continue // Negative patterns are forbidden in .gitattributes
+			}
+			for _, attr := range fields[1:] {
+				switch attr {
+				case "linguist-generated", "linguist-generated=true":
+					rules = append(rules, attributeRule{pattern, true})
+				case "-linguist-generated", "linguist-generated=false", "!linguist-generated":
+					rules = append(rules, attributeRule{pattern, false})
+				}
+			}
+		}
+		f.Close()
+	}
+	a.rules[dir] = rules
+	return rules
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files under testdata/golden")
+
+var fixtureTime = time.Date(2024, time.March, 1, 9, 30, 0, 0, time.UTC)
+
+// fixture is a small storefront admin repository, mounted at "fixture" in
+// the working directory. The log is excluded by .gitignore, the generated
+// file by .gitattributes and node_modules by the built-in rules.
+var fixture = fstest.MapFS{
+	"fixture/.git/HEAD":                   {Data: []byte("ref: refs/heads/main\n"), ModTime: fixtureTime},
+	"fixture/.gitattributes":              {Data: []byte("src/generated.ts linguist-generated\n"), ModTime: fixtureTime},
+	"fixture/src/generated.ts":            {Data: []byte("// Code generated. DO NOT EDIT.\n"), ModTime: fixtureTime},
+	"fixture/.gitignore":                  {Data: []byte("*.log\n"), ModTime: fixtureTime},
+	"fixture/README.md":                   {Data: []byte("# Admin\n\nStorefront admin panel.\n"), ModTime: fixtureTime},
+	"fixture/package.json":                {Data: []byte(`{"name": "admin"}` + "\n"), ModTime: fixtureTime},
+	"fixture/debug.log":                   {Data: []byte("ignored\n"), ModTime: fixtureTime},
+	"fixture/node_modules/react/index.js": {Data: []byte("module.exports = {}\n"), ModTime: fixtureTime},
+	"fixture/src/app/page.tsx":            {Data: []byte("export default function Page() {\n  return null\n}\n"), ModTime: fixtureTime},
+	"fixture/src/app/layout.tsx":          {Data: []byte("export default function Layout() {}\n"), ModTime: fixtureTime},
+	"fixture/src/components/Button.tsx":   {Data: []byte("export const Button = () => null\n"), ModTime: fixtureTime},
+	"fixture/src/lib/utils.ts":            {Data: []byte("export const noop = () => {}\n"), ModTime: fixtureTime},
+	"fixture/src/lib/__tests__/utils.ts":  {Data: []byte("test('noop', () => {})\n"), ModTime: fixtureTime},
+	"fixture/src/app":                     {Mode: os.ModeDir | 0o755, ModTime: fixtureTime},
+	"fixture/src/components":              {Mode: os.ModeDir | 0o755, ModTime: fixtureTime},
+	"fixture/src/lib":                     {Mode: os.ModeDir | 0o755, ModTime: fixtureTime},
+	"fixture/src/lib/__tests__":           {Mode: os.ModeDir | 0o755, ModTime: fixtureTime},
+	"fixture/src":                         {Mode: os.ModeDir | 0o755, ModTime: fixtureTime},
+	"fixture/node_modules":                {Mode: os.ModeDir | 0o755, ModTime: fixtureTime},
+	"fixture/node_modules/react":          {Mode: os.ModeDir | 0o755, ModTime: fixtureTime},
+	"fixture":                             {Mode: os.ModeDir | 0o755, ModTime: fixtureTime},
+}
+
+// useFixture serves fs in place of the real filesystem for the test.
+func useFixture(t *testing.T, fs fstest.MapFS) {
+	t.Helper()
+	mounted, err := mountFS(fs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := fsys
+	fsys = mounted
+	invalidateIgnoreFiles()
+	t.Cleanup(func() {
+		fsys = previous
+		invalidateIgnoreFiles()
+	})
+}
+
+// Lines that change with the build and the time of the run.
+var unstableOutput = regexp.MustCompile(`(?m)^# Generated by .*\n\n|^  "(generator|generatedAt)": ".*",\n`)
+
+func TestGoldenOutputs(t *testing.T) {
+	useFixture(t, fixture)
+	configureIgnores(Config{})
+
+	tree, err := buildLocalTree(context.Background(), "fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := []generatedRoot{newGeneratedRoot(context.Background(), "fixture", tree)}
+
+	golden := map[string]string{
+		"text":   "tree.txt",
+		"json":   "tree.json",
+		"jsonl":  "tree.jsonl",
+		"csv":    "tree.csv",
+		"tsv":    "tree.tsv",
+		"sha256": "tree.sha256",
+		"bundle": "tree.md",
+	}
+	for format, name := range golden {
+		t.Run(format, func(t *testing.T) {
+			data, err := render(format, roots, RenderConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = unstableOutput.ReplaceAll(data, nil)
+			path := filepath.Join("testdata", "golden", name)
+			if *update {
+				if err := os.WriteFile(path, data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Errorf("%s output differs from %s:\n%s", format, path, data)
+			}
+		})
+	}
+}
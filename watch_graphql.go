@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// graphqlSchema is served at /graphql. Paths are as in the JSON output:
+// slash-separated and starting with the configured directory.
+const graphqlSchema = `
+scalar Time
+
+type Query {
+	node(path: String!): Node
+	children(path: String!): [Node!]!
+	search(query: String!): [SearchResult!]!
+	# since is an RFC 3339 time or a duration such as "15m"; all retained
+	# changes are returned without it.
+	recentChanges(since: String): [Change!]!
+}
+
+type Node {
+	id: ID!
+	name: String!
+	path: String!
+	kind: String!
+	size: Float!
+	mtime: Time!
+	generated: Boolean!
+	children: [Node!]!
+}
+
+type SearchResult {
+	root: String!
+	path: String!
+	ext: String!
+	size: Float!
+	mtime: Time!
+}
+
+type Change {
+	path: String!
+	op: String!
+	time: Time!
+}
+`
+
+// latestTrees is the document most recently generated, for queries.
+var latestTrees struct {
+	mu  sync.RWMutex
+	doc *watchapi.Document
+}
+
+func setLatestTrees(doc *watchapi.Document) {
+	latestTrees.mu.Lock()
+	latestTrees.doc = doc
+	latestTrees.mu.Unlock()
+}
+
+// maxRecentChanges is how many events recentChanges retains.
+const maxRecentChanges = 1000
+
+// changeLog keeps the most recent filesystem events, oldest first.
+type changeLog struct {
+	mu      sync.Mutex
+	changes []recordedChange
+}
+
+type recordedChange struct {
+	path string
+	op   string
+	time time.Time
+}
+
+var recentChanges changeLog
+
+func (l *changeLog) record(event fsnotify.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.changes) == maxRecentChanges {
+		l.changes = append(l.changes[:0], l.changes[1:]...)
+	}
+	l.changes = append(l.changes, recordedChange{
+		path: filepath.ToSlash(event.Name),
+		op:   strings.ToLower(event.Op.String()),
+		time: time.Now(),
+	})
+}
+
+func (l *changeLog) since(t time.Time) []recordedChange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []recordedChange
+	for _, c := range l.changes {
+		if !c.time.Before(t) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// newGraphQLHandler parses the schema and returns the /graphql handler.
+func newGraphQLHandler(idx *fileIndex) (*relay.Handler, error) {
+	schema, err := graphql.ParseSchema(graphqlSchema, &graphqlResolver{idx: idx})
+	if err != nil {
+		return nil, err
+	}
+	return &relay.Handler{Schema: schema}, nil
+}
+
+type graphqlResolver struct {
+	idx *fileIndex
+}
+
+func (r *graphqlResolver) Node(args struct{ Path string }) *graphqlNode {
+	if n := findSchemaNode(args.Path); n != nil {
+		return &graphqlNode{n}
+	}
+	return nil
+}
+
+func (r *graphqlResolver) Children(args struct{ Path string }) ([]*graphqlNode, error) {
+	n := findSchemaNode(args.Path)
+	if n == nil {
+		return nil, errors.New("no such path: " + args.Path)
+	}
+	return (&graphqlNode{n}).Children(), nil
+}
+
+func (r *graphqlResolver) Search(args struct{ Query string }) ([]*graphqlSearchResult, error) {
+	if r.idx == nil {
+		return nil, errors.New("index is not enabled")
+	}
+	var results []*graphqlSearchResult
+	for _, e := range r.idx.search(args.Query) {
+		results = append(results, &graphqlSearchResult{e})
+	}
+	return results, nil
+}
+
+func (r *graphqlResolver) RecentChanges(args struct{ Since *string }) ([]*graphqlChange, error) {
+	var since time.Time
+	if args.Since != nil {
+		if d, err := time.ParseDuration(*args.Since); err == nil {
+			since = time.Now().Add(-d)
+		} else if since, err = time.Parse(time.RFC3339, *args.Since); err != nil {
+			return nil, errors.New("since must be an RFC 3339 time or a duration")
+		}
+	}
+	var changes []*graphqlChange
+	for _, c := range recentChanges.since(since) {
+		changes = append(changes, &graphqlChange{c})
+	}
+	return changes, nil
+}
+
+// findSchemaNode returns the node at p in the latest document, if any.
+func findSchemaNode(p string) *watchapi.Node {
+	latestTrees.mu.RLock()
+	doc := latestTrees.doc
+	latestTrees.mu.RUnlock()
+	if doc == nil {
+		return nil
+	}
+	var find func(n *watchapi.Node) *watchapi.Node
+	find = func(n *watchapi.Node) *watchapi.Node {
+		if n.Path == p {
+			return n
+		}
+		for _, child := range n.Children {
+			if child.Path == p || strings.HasPrefix(p, child.Path+"/") {
+				return find(child)
+			}
+		}
+		return nil
+	}
+	for _, root := range doc.Roots {
+		if root.Tree == nil {
+			continue
+		}
+		if n := find(root.Tree); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+type graphqlNode struct{ n *watchapi.Node }
+
+func (n *graphqlNode) ID() graphql.ID      { return graphql.ID(n.n.ID) }
+func (n *graphqlNode) Name() string        { return n.n.Name }
+func (n *graphqlNode) Path() string        { return n.n.Path }
+func (n *graphqlNode) Kind() string        { return n.n.Kind }
+func (n *graphqlNode) Size() float64       { return float64(n.n.Size) }
+func (n *graphqlNode) Mtime() graphql.Time { return graphql.Time{Time: n.n.ModTime} }
+func (n *graphqlNode) Generated() bool     { return n.n.Generated }
+
+func (n *graphqlNode) Children() []*graphqlNode {
+	children := []*graphqlNode{}
+	for _, child := range n.n.Children {
+		children = append(children, &graphqlNode{child})
+	}
+	return children
+}
+
+type graphqlSearchResult struct{ e indexEntry }
+
+func (r *graphqlSearchResult) Root() string        { return redactText(r.e.Root) }
+func (r *graphqlSearchResult) Path() string        { return redactText(r.e.Path) }
+func (r *graphqlSearchResult) Ext() string         { return r.e.Ext }
+func (r *graphqlSearchResult) Size() float64       { return float64(r.e.Size) }
+func (r *graphqlSearchResult) Mtime() graphql.Time { return graphql.Time{Time: r.e.ModTime} }
+
+type graphqlChange struct{ c recordedChange }
+
+func (c *graphqlChange) Path() string       { return redactText(c.c.path) }
+func (c *graphqlChange) Op() string         { return c.c.op }
+func (c *graphqlChange) Time() graphql.Time { return graphql.Time{Time: c.c.time} }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// maxMatchesPerFile caps the lines reported for one file.
+const maxMatchesPerFile = 20
+
+// grepRoot holds the content matches under one watched root.
+type grepRoot struct {
+	Root  string      `json:"root"`
+	Files []grepMatch `json:"files"`
+}
+
+type grepMatch struct {
+	Path  string     `json:"path"`
+	Lines []grepLine `json:"lines"`
+}
+
+type grepLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// grep returns the lines containing query (case-insensitive) in indexed
+// text files, grouped by root. The trigram index narrows the files read;
+// it needs content indexing enabled.
+func (idx *fileIndex) grep(query string) []grepRoot {
+	lower := []byte(strings.ToLower(query))
+	wanted := trigrams(string(lower))
+
+	idx.mu.RLock()
+	var candidates []indexEntry
+	for _, e := range idx.entries {
+		if len(e.Trigrams) == 0 {
+			continue // Binary, empty or not indexed
+		}
+		if len(wanted) == 0 || containsAll(e.Trigrams, wanted) {
+			candidates = append(candidates, *e)
+		}
+	}
+	idx.mu.RUnlock()
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Root != candidates[j].Root {
+			return candidates[i].Root < candidates[j].Root
+		}
+		return candidates[i].Path < candidates[j].Path
+	})
+
+	var results []grepRoot
+	files := 0
+	for _, e := range candidates {
+		lines := grepFile(e.Path, lower)
+		if len(lines) == 0 {
+			continue
+		}
+		root := redactText(e.Root)
+		if len(results) == 0 || results[len(results)-1].Root != root {
+			results = append(results, grepRoot{Root: root})
+		}
+		group := &results[len(results)-1]
+		group.Files = append(group.Files, grepMatch{Path: redactText(e.Path), Lines: lines})
+		if files++; files == maxSearchResults {
+			break
+		}
+	}
+	return results
+}
+
+// grepFile returns the lines of path containing the lowercase query.
+func grepFile(path string, query []byte) []grepLine {
+	data, err := fsys.ReadFile(path)
+	if err != nil || bytes.IndexByte(data, 0) != -1 {
+		return nil
+	}
+	var lines []grepLine
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineCountSize)
+	for n := 1; scanner.Scan(); n++ {
+		if bytes.Contains(bytes.ToLower(scanner.Bytes()), query) {
+			lines = append(lines, grepLine{Line: n, Text: strings.TrimRight(scanner.Text(), "\r")})
+			if len(lines) == maxMatchesPerFile {
+				break
+			}
+		}
+	}
+	return lines
+}
+
+// handleGrep answers /search?q=<text>&content=1.
+func handleGrep(w http.ResponseWriter, query string, idx *fileIndex) {
+	if !idx.content {
+		http.Error(w, "content indexing is not enabled", http.StatusNotFound)
+		return
+	}
+	results := idx.grep(query)
+	if results == nil {
+		results = []grepRoot{}
+	}
+	writeJSON(w, results)
+}
+
+// runGrep implements `watch grep <text>` against the saved index. Like
+// grep(1) it exits with status 1 when nothing matches.
+func runGrep(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: watch grep <text>")
+	}
+	idx, err := loadIndex()
+	if err != nil {
+		log.Fatalf("Error loading %s (is the index enabled in %s?): %v", indexFileName, configFileName, err)
+	}
+	if !idx.content {
+		log.Fatalf("%s has no content; set index.content in %s", indexFileName, configFileName)
+	}
+	results := idx.grep(strings.Join(args, " "))
+	for i, root := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s:\n", root.Root)
+		for _, file := range root.Files {
+			for _, line := range file.Lines {
+				fmt.Printf("%s:%d: %s\n", file.Path, line.Line, line.Text)
+			}
+		}
+	}
+	if len(results) == 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Number of entries listed in each "Most changed" section by default.
+const defaultHeatmapTop = 10
+
+// HeatmapConfig adds the most frequently changed files and directories to
+// each root's summary, to spot churn hotspots such as codegen loops.
+type HeatmapConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	Top     int  `json:"top,omitempty"` // Entries per section, defaults to 10
+
+	// Keeps counts across sessions in this file, e.g. "watch-heatmap.json".
+	// Without it counts cover the current session only.
+	File string `json:"file,omitempty"`
+}
+
+func (h HeatmapConfig) top() int {
+	if h.Top <= 0 {
+		return defaultHeatmapTop
+	}
+	return h.Top
+}
+
+// changeCounts counts settle cycles in which each path changed. A change
+// also counts towards every directory above it within its root.
+type changeCounts struct {
+	mu    sync.Mutex
+	file  string
+	top   int
+	Files map[string]int `json:"files"`
+	Dirs  map[string]int `json:"dirs"`
+}
+
+// heatmap is set when the heatmap is enabled.
+var heatmap *changeCounts
+
+// loadChangeCounts reads persisted counts from the configured file, if
+// set and present.
+func loadChangeCounts(config HeatmapConfig) (*changeCounts, error) {
+	file := config.File
+	c := &changeCounts{file: file, top: config.top(), Files: make(map[string]int), Dirs: make(map[string]int)}
+	if file == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return c, err
+	}
+	if c.Files == nil {
+		c.Files = make(map[string]int)
+	}
+	if c.Dirs == nil {
+		c.Dirs = make(map[string]int)
+	}
+	return c, nil
+}
+
+// record counts a change to path, a file unless it is an existing
+// directory.
+func (c *changeCounts) record(root, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if info, err := fsys.Stat(path); err == nil && info.IsDir() {
+		c.Dirs[path]++
+	} else {
+		c.Files[path]++
+	}
+	for dir := filepath.Dir(path); dir != root && dir != "." && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		c.Dirs[dir]++
+	}
+}
+
+// save writes the counts to their file, if any.
+func (c *changeCounts) save() error {
+	if c.file == "" {
+		return nil
+	}
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.file, data, 0644)
+}
+
+// section renders the summary lines for the paths under root, or "" if
+// none has changed.
+func (c *changeCounts) section(root string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var builder strings.Builder
+	for _, s := range []struct {
+		title  string
+		counts map[string]int
+		suffix string
+	}{
+		{"Most changed files", c.Files, ""},
+		{"Most changed directories", c.Dirs, "/"},
+	} {
+		type entry struct {
+			path  string
+			count int
+		}
+		var entries []entry
+		for path, count := range s.counts {
+			if rootFor([]string{root}, path) != "" {
+				entries = append(entries, entry{path, count})
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].count != entries[j].count {
+				return entries[i].count > entries[j].count
+			}
+			return entries[i].path < entries[j].path
+		})
+		if len(entries) > c.top {
+			entries = entries[:c.top]
+		}
+		builder.WriteString(fmt.Sprintf("  %s:\n", s.title))
+		for _, e := range entries {
+			builder.WriteString(fmt.Sprintf("    %-30s %6s\n", filepath.ToSlash(e.path)+s.suffix, plural(e.count, "change")))
+		}
+	}
+	return builder.String()
+}
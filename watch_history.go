@@ -0,0 +1,240 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layout of the timestamp embedded in snapshot file names. Colons are
+// avoided so the names are valid on Windows.
+const snapshotTimeLayout = "2006-01-02T15-04-05"
+
+// HistoryConfig makes a file output keep every generation as its own
+// timestamped file instead of overwriting a single path.
+type HistoryConfig struct {
+	Dir    string `json:"dir,omitempty"`    // Defaults to "snapshots"
+	Prefix string `json:"prefix,omitempty"` // Defaults to "tree"
+
+	// Retention. A snapshot survives if any rule keeps it; with no rules
+	// set every snapshot is kept.
+	KeepLast      int `json:"keepLast,omitempty"`      // Newest N snapshots
+	KeepDailyDays int `json:"keepDailyDays,omitempty"` // Newest snapshot of each of the last M days
+
+	// Hard limits applied after the retention rules, oldest snapshots
+	// first. The newest snapshot is never removed.
+	MaxCount     int      `json:"maxCount,omitempty"`
+	MaxAge       Duration `json:"maxAge,omitzero"`
+	MaxTotalSize ByteSize `json:"maxTotalSize,omitempty"` // e.g. "500MB"
+}
+
+func (h HistoryConfig) dir() string {
+	if h.Dir == "" {
+		return "snapshots"
+	}
+	return h.Dir
+}
+
+func (h HistoryConfig) prefix() string {
+	if h.Prefix == "" {
+		return "tree"
+	}
+	return h.Prefix
+}
+
+// historySink writes each generation to <dir>/<prefix>-<timestamp><ext>
+// and prunes old snapshots afterwards.
+type historySink struct {
+	history HistoryConfig
+	ext     string
+	perms   filePerms
+}
+
+func (s historySink) Write(data []byte) error {
+	dir := s.history.dir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// Generations within the same second get a counter, "-2" onwards,
+	// rather than overwriting each other.
+	stamp := time.Now().Format(snapshotTimeLayout)
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s%s", s.history.prefix(), stamp, s.ext))
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%s-%d%s", s.history.prefix(), stamp, n, s.ext))
+	}
+	if err := s.perms.writeFile(path, data); err != nil {
+		return err
+	}
+	if _, err := pruneSnapshots(s.history, s.ext, time.Now(), false); err != nil {
+		log.Printf("Error pruning %s: %v\n", dir, err)
+	}
+	return nil
+}
+
+func (s historySink) String() string {
+	return filepath.Join(s.history.dir(), s.history.prefix()+"-*"+s.ext)
+}
+
+type snapshotFile struct {
+	path string
+	time time.Time
+	seq  int // Counter of snapshots taken within the same second
+	size int64
+}
+
+// listSnapshots returns the snapshots in the history directory, newest first.
+func listSnapshots(history HistoryConfig, ext string) ([]snapshotFile, error) {
+	entries, err := os.ReadDir(history.dir())
+	if err != nil {
+		return nil, err
+	}
+	prefix := history.prefix() + "-"
+	var snaps []snapshotFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		if len(stamp) < len(snapshotTimeLayout) {
+			continue
+		}
+		t, err := time.ParseInLocation(snapshotTimeLayout, stamp[:len(snapshotTimeLayout)], time.Local)
+		if err != nil {
+			continue
+		}
+		seq := 1
+		if counter := stamp[len(snapshotTimeLayout):]; counter != "" {
+			n, err := strconv.Atoi(strings.TrimPrefix(counter, "-"))
+			if err != nil || !strings.HasPrefix(counter, "-") || n < 2 {
+				continue
+			}
+			seq = n
+		}
+		var size int64
+		if info, err := entry.Info(); err == nil {
+			size = info.Size()
+		}
+		snaps = append(snaps, snapshotFile{path: filepath.Join(history.dir(), name), time: t, seq: seq, size: size})
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		if snaps[i].time.Equal(snaps[j].time) {
+			return snaps[i].seq > snaps[j].seq
+		}
+		return snaps[i].time.After(snaps[j].time)
+	})
+	return snaps, nil
+}
+
+// pruneSnapshots deletes snapshots no retention rule keeps, then enforces
+// the hard limits. It returns the removed paths; with dryRun nothing is
+// deleted.
+func pruneSnapshots(history HistoryConfig, ext string, now time.Time, dryRun bool) ([]string, error) {
+	snaps, err := listSnapshots(history, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool)
+	if history.KeepLast == 0 && history.KeepDailyDays == 0 {
+		for _, snap := range snaps {
+			keep[snap.path] = true
+		}
+	}
+	for i := 0; i < history.KeepLast && i < len(snaps); i++ {
+		keep[snaps[i].path] = true
+	}
+	if history.KeepDailyDays > 0 {
+		cutoff := now.AddDate(0, 0, -history.KeepDailyDays)
+		seenDays := make(map[string]bool)
+		for _, snap := range snaps {
+			if snap.time.Before(cutoff) {
+				break
+			}
+			day := snap.time.Format("2006-01-02")
+			if !seenDays[day] {
+				seenDays[day] = true
+				keep[snap.path] = true
+			}
+		}
+	}
+
+	var count int
+	var total int64
+	for i, snap := range snaps {
+		if !keep[snap.path] || i == 0 {
+			continue
+		}
+		count++
+		total += snap.size
+		switch {
+		case history.MaxCount > 0 && count >= history.MaxCount:
+			keep[snap.path] = false
+		case history.MaxAge.Duration > 0 && now.Sub(snap.time) > history.MaxAge.Duration:
+			keep[snap.path] = false
+		case history.MaxTotalSize > 0 && total+snaps[0].size > int64(history.MaxTotalSize):
+			keep[snap.path] = false
+		}
+	}
+	if len(snaps) > 0 {
+		keep[snaps[0].path] = true
+	}
+
+	var removed []string
+	for _, snap := range snaps {
+		if keep[snap.path] {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(snap.path); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, snap.path)
+	}
+	return removed, nil
+}
+
+// runPrune implements `watch prune`, applying every history output's
+// retention settings on demand.
+func runPrune(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "List the snapshots that would be removed")
+	fs.Parse(args)
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Error loading %s: %v", configFileName, err)
+	}
+	for _, o := range config.outputs() {
+		sink, err := newSink(o)
+		if err != nil {
+			continue
+		}
+		hs, ok := sink.(historySink)
+		if !ok {
+			continue
+		}
+		removed, err := pruneSnapshots(hs.history, hs.ext, time.Now(), *dryRun)
+		if err != nil {
+			log.Printf("Error pruning %s: %v\n", hs, err)
+		}
+		verb := "Removed"
+		if *dryRun {
+			verb = "Would remove"
+		}
+		for _, path := range removed {
+			fmt.Printf("%s %s\n", verb, path)
+		}
+		fmt.Printf("%s: %s %d snapshots\n", hs, strings.ToLower(verb), len(removed))
+	}
+}
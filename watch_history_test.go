@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistorySinkSameSecond(t *testing.T) {
+	history := HistoryConfig{Dir: t.TempDir()}
+	sink := historySink{history: history, ext: ".txt", perms: filePerms{gid: -1}}
+	for _, data := range []string{"first", "second", "third"} {
+		if err := sink.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snaps, err := listSnapshots(history, ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 3 {
+		t.Fatalf("got %d snapshots, want 3", len(snaps))
+	}
+	newest, err := os.ReadFile(snaps[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(newest) != "third" {
+		t.Errorf("newest snapshot %s holds %q, want %q", filepath.Base(snaps[0].path), newest, "third")
+	}
+}
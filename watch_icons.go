@@ -0,0 +1,117 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Built-in icon sets, keyed by lowercase file name or extension. "dir" and
+// "file" are the fallbacks.
+var iconSets = map[string]map[string]string{
+	"emoji": {
+		"dir":      "📁",
+		"file":     "📄",
+		".go":      "🐹",
+		".ts":      "🟦",
+		".tsx":     "⚛️",
+		".js":      "🟨",
+		".jsx":     "⚛️",
+		".json":    "🔧",
+		".md":      "📝",
+		".css":     "🎨",
+		".scss":    "🎨",
+		".html":    "🌐",
+		".png":     "🖼️",
+		".jpg":     "🖼️",
+		".jpeg":    "🖼️",
+		".gif":     "🖼️",
+		".webp":    "🖼️",
+		".svg":     "🖼️",
+		".mp4":     "🎞️",
+		".webm":    "🎞️",
+		".mov":     "🎞️",
+		".yml":     "⚙️",
+		".yaml":    "⚙️",
+		".toml":    "⚙️",
+		".sh":      "🐚",
+		".sql":     "🗃️",
+		".graphql": "🕸️",
+		".gql":     "🕸️",
+		".lock":    "🔒",
+	},
+	// Nerd Font glyphs, from the private use area.
+	"nerd": {
+		"dir":      "\uf07b",
+		"file":     "\uf15b",
+		".go":      "\ue626",
+		".ts":      "\ue628",
+		".tsx":     "\ue7ba",
+		".js":      "\ue74e",
+		".jsx":     "\ue7ba",
+		".json":    "\ue60b",
+		".md":      "\ue609",
+		".css":     "\ue749",
+		".scss":    "\ue749",
+		".html":    "\ue736",
+		".png":     "\uf1c5",
+		".jpg":     "\uf1c5",
+		".jpeg":    "\uf1c5",
+		".gif":     "\uf1c5",
+		".webp":    "\uf1c5",
+		".svg":     "\uf1c5",
+		".mp4":     "\uf1c8",
+		".webm":    "\uf1c8",
+		".mov":     "\uf1c8",
+		".yml":     "\uf013",
+		".yaml":    "\uf013",
+		".toml":    "\uf013",
+		".sh":      "\uf489",
+		".sql":     "\uf1c0",
+		".graphql": "\ue662",
+		".gql":     "\ue662",
+		".lock":    "\uf023",
+	},
+}
+
+// icon returns the icon for node, or "" when icons are off. IconMap
+// entries take precedence over the chosen set.
+func (opts RenderConfig) icon(node *treeNode) string {
+	if plainOutput || (opts.Icons == "" && opts.IconMap == nil) {
+		return ""
+	}
+	set := iconSets[opts.Icons]
+	lookup := func(key string) string {
+		if icon, ok := opts.IconMap[key]; ok {
+			return icon
+		}
+		return set[key]
+	}
+	if node.IsDir {
+		return lookup("dir")
+	}
+	name := strings.ToLower(node.Name)
+	if icon := lookup(name); icon != "" {
+		return icon
+	}
+	if icon := lookup(filepath.Ext(name)); icon != "" {
+		return icon
+	}
+	return lookup("file")
+}
+
+// stripIcon removes a leading icon from a rendered name. Icons are
+// recognized as runs of symbols, emoji or private-use glyphs followed by a
+// space, so custom icons made of letters aren't stripped.
+func stripIcon(name string) string {
+	icon, rest, ok := strings.Cut(name, " ")
+	if !ok || icon == "" {
+		return name
+	}
+	for _, r := range icon {
+		if r < unicode.MaxASCII || !(unicode.IsSymbol(r) || unicode.Is(unicode.Co, r) || unicode.Is(unicode.Variation_Selector, r) || unicode.IsMark(r)) {
+			return name
+		}
+	}
+	return rest
+}
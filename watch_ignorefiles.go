@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Ignore files read in every directory, in ascending precedence as in
+// ripgrep. .gitignore only applies inside a git repository.
+var ignoreFileNames = []string{".gitignore", ".ignore", ".rgignore"}
+
+type ignoreRule struct {
+	pattern gitPattern
+	desc    string // "<file>: <pattern>", shown by --dry-run
+}
+
+type dirIgnores struct {
+	inRepo bool
+	rules  []ignoreRule
+}
+
+// Parsed ignore files per directory, dropped whenever one of them changes.
+var (
+	ignoreFilesMu   sync.Mutex
+	ignoreFileCache = make(map[string]*dirIgnores)
+)
+
+func invalidateIgnoreFiles() {
+	ignoreFilesMu.Lock()
+	clear(ignoreFileCache)
+	ignoreFilesMu.Unlock()
+}
+
+func isIgnoreFile(path string) bool {
+	name := filepath.Base(path)
+	for _, n := range ignoreFileNames {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDirIgnores returns the rules from dir's ignore files. The caller
+// holds ignoreFilesMu.
+func loadDirIgnores(dir string) *dirIgnores {
+	if d, ok := ignoreFileCache[dir]; ok {
+		return d
+	}
+	d := &dirIgnores{}
+	if _, err := fsys.Stat(filepath.Join(dir, ".git")); err == nil {
+		d.inRepo = true
+	} else if parent := filepath.Dir(dir); parent != dir {
+		d.inRepo = loadDirIgnores(parent).inRepo
+	}
+	for _, name := range ignoreFileNames {
+		if name == ".gitignore" && !d.inRepo {
+			continue
+		}
+		file := filepath.Join(dir, name)
+		f, err := fsys.Open(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), " \t\r")
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if pattern, ok := compileGitPattern(line); ok {
+				d.rules = append(d.rules, ignoreRule{pattern: pattern, desc: file + ": " + line})
+			}
+		}
+		f.Close()
+	}
+	ignoreFileCache[dir] = d
+	return d
+}
+
+// matchIgnoreFiles returns the rule from a .gitignore, .ignore or
+// .rgignore file that excludes path or one of its parent directories, or
+// "". Files in deeper directories override those above them, and the last
+// matching line of a file wins, so "!pattern" can re-include a path.
+func matchIgnoreFiles(path string) string {
+	match, _ := ignoreFileRules(path)
+	return match
+}
+
+// ignoreFileRules returns the ignore file rule excluding path, or else
+// the negated rule, if any, that re-included it.
+func ignoreFileRules(path string) (match, reincluded string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", ""
+	}
+	// Every directory from the filesystem root down to path's parent.
+	var dirs []string
+	for d := filepath.Dir(abs); ; d = filepath.Dir(d) {
+		dirs = append(dirs, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	for i, j := 0, len(dirs)-1; i < j; i, j = i+1, j-1 {
+		dirs[i], dirs[j] = dirs[j], dirs[i]
+	}
+
+	ignoreFilesMu.Lock()
+	defer ignoreFilesMu.Unlock()
+
+	// Check each ancestor before path itself: nothing inside an excluded
+	// directory can be re-included.
+	for k := 1; k <= len(dirs); k++ {
+		candidate, isDir := abs, false
+		if k < len(dirs) {
+			candidate, isDir = dirs[k], true
+		} else if info, err := fsys.Stat(abs); err == nil {
+			isDir = info.IsDir()
+		}
+		match := ""
+		for _, dir := range dirs[:k] {
+			rel, err := filepath.Rel(dir, candidate)
+			if err != nil {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			for _, rule := range loadDirIgnores(dir).rules {
+				if rule.pattern.match(rel, isDir) {
+					match = rule.desc
+					if rule.pattern.negate {
+						match = ""
+						reincluded = rule.desc
+					}
+				}
+			}
+		}
+		if match != "" {
+			return match, ""
+		}
+	}
+	return "", reincluded
+}
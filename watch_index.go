@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const indexFileName = ".watch-index.json"
+
+// Maximum number of results returned by a search.
+const maxSearchResults = 200
+
+type IndexConfig struct {
+	Enabled bool `json:"enabled"`
+	Content bool `json:"content"` // Also index content trigrams of text files
+}
+
+type indexEntry struct {
+	Root     string    `json:"root"`
+	Path     string    `json:"path"`
+	Ext      string    `json:"ext"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Trigrams []string  `json:"trigrams,omitempty"`
+}
+
+// fileIndex is a flat index of every non-ignored file under the watched
+// roots. It is rebuilt on startup and updated per event afterwards.
+type fileIndex struct {
+	mu      sync.RWMutex
+	content bool
+	entries map[string]*indexEntry
+}
+
+func newFileIndex(content bool) *fileIndex {
+	return &fileIndex{content: content, entries: make(map[string]*indexEntry)}
+}
+
+// indexVersion is bumped whenever saved indexes can't be read as they
+// are; the watcher rebuilds the index when it starts.
+const indexVersion = 2
+
+// savedIndex is the index file.
+type savedIndex struct {
+	Version int           `json:"version"`
+	Entries []*indexEntry `json:"entries"`
+}
+
+// loadIndex reads a previously saved index from disk.
+func loadIndex() (*fileIndex, error) {
+	data, err := os.ReadFile(indexFileName)
+	if err != nil {
+		return nil, err
+	}
+	var saved savedIndex
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		saved.Version = 1 // A bare list of entries
+	} else if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	if saved.Version != indexVersion {
+		return nil, fmt.Errorf("written by another version of watch; restart the watcher to rebuild it")
+	}
+	idx := newFileIndex(false)
+	for _, e := range saved.Entries {
+		if len(e.Trigrams) > 0 {
+			idx.content = true
+		}
+		idx.entries[e.Path] = e
+	}
+	return idx, nil
+}
+
+func (idx *fileIndex) save() error {
+	idx.mu.RLock()
+	list := make([]*indexEntry, 0, len(idx.entries))
+	for _, e := range idx.entries {
+		list = append(list, e)
+	}
+	idx.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+
+	data, err := json.Marshal(savedIndex{Version: indexVersion, Entries: list})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(indexFileName, data, 0644)
+}
+
+// rebuild replaces the index contents with a fresh walk of directories.
+func (idx *fileIndex) rebuild(directories []string) {
+	entries := make(map[string]*indexEntry)
+	for _, dir := range directories {
+		if isRemoteRoot(dir) {
+			continue
+		}
+		err := walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != dir && isIgnored(path) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.IsDir() {
+				entries[path] = idx.newEntry(dir, path, info)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error indexing %s: %v\n", dir, err)
+		}
+	}
+
+	idx.mu.Lock()
+	idx.entries = entries
+	idx.mu.Unlock()
+}
+
+// update refreshes the entries for path after a filesystem event. It
+// reports whether the index changed.
+func (idx *fileIndex) update(directories []string, path string) bool {
+	if isIgnored(path) {
+		return false
+	}
+	root := rootFor(directories, path)
+	if root == "" {
+		return false
+	}
+
+	info, err := fsys.Stat(path)
+	if err != nil {
+		// The path is gone; drop it and anything that lived beneath it.
+		idx.mu.Lock()
+		defer idx.mu.Unlock()
+		prefix := path + string(os.PathSeparator)
+		changed := false
+		for p := range idx.entries {
+			if p == path || strings.HasPrefix(p, prefix) {
+				delete(idx.entries, p)
+				changed = true
+			}
+		}
+		return changed
+	}
+
+	if !info.IsDir() {
+		entry := idx.newEntry(root, path, info)
+		idx.mu.Lock()
+		idx.entries[path] = entry
+		idx.mu.Unlock()
+		return true
+	}
+
+	walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if isIgnored(p) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.IsDir() {
+			entry := idx.newEntry(root, p, fi)
+			idx.mu.Lock()
+			idx.entries[p] = entry
+			idx.mu.Unlock()
+		}
+		return nil
+	})
+	return true
+}
+
+func (idx *fileIndex) newEntry(root, path string, info os.FileInfo) *indexEntry {
+	entry := &indexEntry{
+		Root:    root,
+		Path:    path,
+		Ext:     strings.ToLower(filepath.Ext(path)),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if idx.content {
+		entry.Trigrams = fileTrigrams(path, info)
+	}
+	return entry
+}
+
+// search returns entries whose path contains query (case-insensitive) or,
+// when content is indexed, whose content contains every trigram of query.
+// Results are copies without trigram data.
+func (idx *fileIndex) search(query string) []indexEntry {
+	query = strings.ToLower(query)
+	wanted := trigrams(query)
+
+	idx.mu.RLock()
+	var results []indexEntry
+	for _, e := range idx.entries {
+		if strings.Contains(strings.ToLower(e.Path), query) || containsAll(e.Trigrams, wanted) {
+			result := *e
+			result.Trigrams = nil
+			results = append(results, result)
+		}
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	if len(results) > maxSearchResults {
+		results = results[:maxSearchResults]
+	}
+	return results
+}
+
+// rootFor returns the watched directory that contains path, or "" if none.
+func rootFor(directories []string, path string) string {
+	for _, dir := range directories {
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// fileTrigrams returns the sorted set of lowercase trigrams in a text file.
+func fileTrigrams(path string, info os.FileInfo) []string {
+	if info.Size() == 0 || info.Size() > maxLineCountSize {
+		return nil
+	}
+	data, err := fsys.ReadFile(path)
+	if err != nil || bytes.IndexByte(data, 0) != -1 {
+		return nil
+	}
+	set := trigrams(strings.ToLower(string(data)))
+	list := make([]string, 0, len(set))
+	for t := range set {
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// trigrams returns the set of three-character sequences in s. They are
+// taken over runes, not bytes, so each is valid UTF-8 and survives saving
+// as JSON; invalid bytes count as U+FFFD in files and queries alike.
+func trigrams(s string) map[string]bool {
+	runes := []rune(s)
+	set := make(map[string]bool)
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = true
+	}
+	return set
+}
+
+// containsAll reports whether the sorted list holds every trigram in wanted.
+func containsAll(list []string, wanted map[string]bool) bool {
+	if len(list) == 0 || len(wanted) == 0 {
+		return false
+	}
+	for t := range wanted {
+		i := sort.SearchStrings(list, t)
+		if i == len(list) || list[i] != t {
+			return false
+		}
+	}
+	return true
+}
+
+// runSearch implements `watch search <query>` against the saved index.
+func runSearch(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: watch search <query>")
+	}
+	idx, err := loadIndex()
+	if err != nil {
+		log.Fatalf("Error loading %s (is the index enabled in %s?): %v", indexFileName, configFileName, err)
+	}
+	for _, e := range idx.search(strings.Join(args, " ")) {
+		fmt.Printf("%s\t%d\t%s\n", e.Path, e.Size, e.ModTime.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContentSearchAfterReload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("src", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	menu := filepath.Join("src", "menu.md")
+	if err := os.WriteFile(menu, []byte("Crème brûlée candle, 8 oz\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	configureIgnores(Config{})
+
+	idx := newFileIndex(true)
+	idx.rebuild([]string{"src"})
+	if err := idx.save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{"crème", "BRÛLÉE", "candle"} {
+		results := loaded.search(query)
+		if len(results) != 1 || results[0].Path != menu {
+			t.Errorf("search(%q) after reloading = %v, want %s", query, results, menu)
+		}
+	}
+}
+
+func TestLoadIndexRejectsOldFormat(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(indexFileName, []byte(`[{"root":"src","path":"src/a.ts"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadIndex(); err == nil {
+		t.Error("loaded an index saved with byte trigrams")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// consoleStatus is the one line the console shows while --log-file
+// takes the logs, so trees printed to stdout aren't buried in them.
+// Nil without --log-file.
+var consoleStatus *statusLine
+
+type statusLine struct {
+	mu       sync.Mutex
+	logFile  string
+	roots    int
+	updated  time.Time
+	errors   int
+	terminal bool // Redraw in place rather than print a line per update
+	shown    bool // Whether the terminal currently shows the line
+}
+
+// openLogFile sends the log to path, appending, and starts the console
+// status line unless the TUI owns the console.
+func openLogFile(path string, tui bool) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatalf("Error opening log file %s: %v", path, err)
+	}
+	if tui {
+		log.SetOutput(file)
+		return
+	}
+	consoleStatus = &statusLine{logFile: path, terminal: isatty.IsTerminal(os.Stderr.Fd())}
+	log.SetOutput(errorCounter{file, consoleStatus})
+}
+
+// errorCounter passes log lines through, counting errors for the status
+// line.
+type errorCounter struct {
+	w      io.Writer
+	status *statusLine
+}
+
+func (c errorCounter) Write(b []byte) (int, error) {
+	if strings.Contains(string(b), "Error") {
+		c.status.mu.Lock()
+		c.status.errors++
+		redraw := c.status.terminal
+		c.status.mu.Unlock()
+		if redraw {
+			c.status.show()
+		}
+	}
+	return c.w.Write(b)
+}
+
+// generated records a finished generation.
+func (s *statusLine) generated(roots int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.roots = roots
+	s.updated = time.Now()
+	s.mu.Unlock()
+	s.show()
+}
+
+func (s *statusLine) show() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.updated.IsZero() {
+		return
+	}
+	line := fmt.Sprintf("Watching %s · updated %s", plural(s.roots, "root"), s.updated.Format("15:04:05"))
+	if s.errors > 0 {
+		line += fmt.Sprintf(" · %s in %s", plural(s.errors, "error"), s.logFile)
+	}
+	if s.terminal {
+		fmt.Fprint(os.Stderr, "\r\x1b[K"+line)
+		s.shown = true
+	} else {
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
+
+// clear erases the status line before something else is printed to the
+// console.
+func (s *statusLine) clear() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shown {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+		s.shown = false
+	}
+}
+
+// finish ends the status line so the shell prompt starts on its own line.
+func (s *statusLine) finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shown {
+		fmt.Fprintln(os.Stderr)
+		s.shown = false
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checksumKey identifies a file version: an unchanged size and mtime mean
+// the cached checksum still holds.
+type checksumKey struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+var (
+	checksumsMu sync.Mutex
+	checksums   = make(map[checksumKey]string)
+)
+
+// fileChecksum returns the hex SHA-256 of a file, reusing the previous
+// result while its size and mtime are unchanged.
+func fileChecksum(path string, size int64, modTime time.Time) (string, error) {
+	key := checksumKey{path, size, modTime}
+	checksumsMu.Lock()
+	sum, ok := checksums[key]
+	checksumsMu.Unlock()
+	if ok {
+		return sum, nil
+	}
+
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+	checksumsMu.Lock()
+	checksums[key] = sum
+	checksumsMu.Unlock()
+	return sum, nil
+}
+
+// renderManifest lists "<sha256>  <path>" for every file of the local
+// roots, in the format of sha256sum(1), so `sha256sum -c` run from the
+// watcher's directory verifies them. Unreadable files are left out.
+func renderManifest(roots []generatedRoot) []byte {
+	var builder strings.Builder
+	for _, record := range fileRecords(roots) {
+		if record.Type != "file" || isRemoteRoot(record.Root) {
+			continue
+		}
+		sum, err := fileChecksum(filepath.FromSlash(record.Path), record.Size, record.ModTime)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&builder, "%s  %s\n", sum, redactText(record.Path))
+	}
+	return []byte(builder.String())
+}
+
+// parseManifest reads "<sha256>  <path>" lines, also accepting the
+// " *<path>" binary-mode marker sha256sum writes with -b.
+func parseManifest(data []byte) (map[string]string, error) {
+	sums := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		sum, path, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != sha256.Size*2 || len(path) < 2 || (path[0] != ' ' && path[0] != '*') {
+			return nil, fmt.Errorf("line %d: not a sha256sum line", i+1)
+		}
+		sums[path[1:]] = strings.ToLower(sum)
+	}
+	return sums, nil
+}
+
+// runVerify compares a checksum manifest with the files currently under
+// the configured roots. It exits 0 when everything matches, 1 when files
+// are missing, extra or modified, and 2 when the check couldn't run.
+func runVerify(args []string) {
+	if len(args) != 1 {
+		log.Print("Usage: watch verify <manifest>")
+		os.Exit(2)
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Printf("Error reading %s: %v", args[0], err)
+		os.Exit(2)
+	}
+	want, err := parseManifest(data)
+	if err != nil {
+		log.Printf("Error parsing %s: %v", args[0], err)
+		os.Exit(2)
+	}
+	config, err := loadConfig()
+	if err != nil {
+		log.Printf("Error loading %s: %v", configFileName, err)
+		os.Exit(2)
+	}
+	configureIgnores(config)
+
+	var roots []generatedRoot
+	for _, dir := range config.Directories {
+		if isRemoteRoot(dir) {
+			continue
+		}
+		tree, err := buildTree(context.Background(), dir)
+		if err != nil {
+			log.Printf("Error building tree for %s: %v", dir, err)
+			os.Exit(2)
+		}
+		roots = append(roots, generatedRoot{Dir: dir, Tree: tree})
+	}
+
+	var missing, extra, modified []string
+	for _, record := range fileRecords(roots) {
+		if record.Type != "file" {
+			continue
+		}
+		if _, ok := want[record.Path]; !ok {
+			extra = append(extra, record.Path)
+		}
+	}
+	for path, sum := range want {
+		info, err := fsys.Stat(filepath.FromSlash(path))
+		if err != nil {
+			missing = append(missing, path)
+			continue
+		}
+		got, err := fileChecksum(filepath.FromSlash(path), info.Size(), info.ModTime())
+		if err != nil || got != sum {
+			modified = append(modified, path)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	sort.Strings(modified)
+
+	for _, path := range modified {
+		fmt.Printf("~ %s\n", path)
+	}
+	for _, path := range missing {
+		fmt.Printf("- %s\n", path)
+	}
+	for _, path := range extra {
+		fmt.Printf("+ %s\n", path)
+	}
+	fmt.Printf("%d files checked: %d modified, %d missing, %d extra\n", len(want), len(modified), len(missing), len(extra))
+	if len(missing)+len(extra)+len(modified) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// treeChanges is what changed in a root since the previous generation,
+// by slash-separated path relative to the root.
+type treeChanges struct {
+	added   map[string]bool
+	removed []string // Topmost removed entries only, sorted
+}
+
+// Paths of each root at the previous generation, true for directories.
+var (
+	previousPathsMu sync.Mutex
+	previousPaths   = make(map[string]map[string]bool)
+)
+
+// markChanges compares each root with the previous generation and
+// attaches the result for the changeMarkers option. Roots seen for the
+// first time get no markers.
+func markChanges(roots []generatedRoot) {
+	previousPathsMu.Lock()
+	defer previousPathsMu.Unlock()
+	for i, root := range roots {
+		current := make(map[string]bool)
+		collectPaths(root.Tree, "", current)
+		previous, seen := previousPaths[root.Dir]
+		previousPaths[root.Dir] = current
+		if !seen {
+			continue
+		}
+
+		changes := &treeChanges{added: make(map[string]bool)}
+		for path := range current {
+			if _, ok := previous[path]; !ok {
+				changes.added[path] = true
+			}
+		}
+		for path := range previous {
+			if _, ok := current[path]; ok {
+				continue
+			}
+			// Entries of a removed directory are covered by it.
+			parent := filepath.ToSlash(filepath.Dir(path))
+			if _, ok := current[parent]; parent != "." && !ok {
+				continue
+			}
+			changes.removed = append(changes.removed, path)
+		}
+		sort.Strings(changes.removed)
+		roots[i].Changes = changes
+	}
+}
+
+func collectPaths(node *treeNode, rel string, paths map[string]bool) {
+	for _, child := range node.Children {
+		path := child.Name
+		if rel != "" {
+			path = rel + "/" + child.Name
+		}
+		paths[path] = child.IsDir
+		collectPaths(child, path, paths)
+	}
+}
+
+// addedMarker returns "+ " for an entry added since the previous
+// generation when markers are on.
+func (opts RenderConfig) addedMarker(path string) string {
+	if opts.changes == nil {
+		return ""
+	}
+	rel, err := filepath.Rel(opts.rootDir, path)
+	if err != nil || !opts.changes.added[filepath.ToSlash(rel)] {
+		return ""
+	}
+	return "+ "
+}
+
+// removedSection lists the entries removed since the previous generation
+// below a root's tree.
+func removedSection(changes *treeChanges) string {
+	if changes == nil || len(changes.removed) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteString("\nRemoved since the last generation:\n")
+	for _, path := range changes.removed {
+		builder.WriteString("- " + redactText(path) + "\n")
+	}
+	return builder.String()
+}
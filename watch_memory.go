@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"runtime/metrics"
+	"strings"
+)
+
+// MemoryConfig caps the heap a generation may use. Past the limit, trees
+// stop descending below ShallowDepth and summaries, which read every
+// file, are skipped, rather than the process growing until it is killed.
+type MemoryConfig struct {
+	Limit        ByteSize `json:"limit,omitempty"`        // e.g. "2GiB"; no limit when unset
+	ShallowDepth int      `json:"shallowDepth,omitempty"` // Levels kept once over the limit, defaults to 3
+}
+
+const defaultShallowDepth = 3
+
+// memoryLimit is set from the config.
+var memoryLimit MemoryConfig
+
+// currentMemoryLimit returns the memoryLimit in effect.
+func currentMemoryLimit() MemoryConfig {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return memoryLimit
+}
+
+// How many walked entries pass between heap checks.
+const memoryCheckInterval = 1024
+
+var heapSample = []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+
+// heapInUse returns the bytes held by live and not yet swept heap objects.
+// Unlike runtime.ReadMemStats it doesn't stop the world.
+func heapInUse() uint64 {
+	metrics.Read(heapSample)
+	return heapSample[0].Value.Uint64()
+}
+
+// memoryGuard watches the heap during one root's walk and counts what was
+// left out once the limit was crossed.
+type memoryGuard struct {
+	root    string
+	limit   MemoryConfig
+	entries int
+	over    bool
+	skipped int
+}
+
+func newMemoryGuard(root string) *memoryGuard {
+	return &memoryGuard{root: root, limit: currentMemoryLimit()}
+}
+
+func (m MemoryConfig) shallowDepth() int {
+	if m.ShallowDepth <= 0 {
+		return defaultShallowDepth
+	}
+	return m.ShallowDepth
+}
+
+// skip is called for every walked entry and reports whether the walk
+// should not descend into it. Once over the limit the guard stays tripped
+// for the rest of the walk.
+func (g *memoryGuard) skip(path string, isDir bool) bool {
+	if g.limit.Limit <= 0 {
+		return false
+	}
+	g.entries++
+	if !g.over && g.entries%memoryCheckInterval == 0 && heapInUse() > uint64(g.limit.Limit) {
+		g.over = true
+	}
+	if !g.over || !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(g.root, path)
+	if err != nil || strings.Count(filepath.ToSlash(rel), "/")+1 < g.limit.shallowDepth() {
+		return false
+	}
+	g.skipped++
+	return true
+}
+
+// report logs what the walk left out.
+func (g *memoryGuard) report() {
+	if g.skipped > 0 {
+		log.Printf("Memory limit %s exceeded while walking %s: %d directories below depth %d were not expanded\n", formatSize(int64(g.limit.Limit)), g.root, g.skipped, g.limit.shallowDepth())
+	}
+}
+
+// overMemoryLimit reports whether the heap is past the configured limit.
+func overMemoryLimit() bool {
+	limit := currentMemoryLimit().Limit
+	return limit > 0 && heapInUse() > uint64(limit)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MimeRule applies to files whose sniffed content type matches Type, such
+// as "video/*" or "application/pdf", whatever their extension.
+type MimeRule struct {
+	Type string `json:"type"`
+	// "exclude" leaves matching files out of every output; "summarize"
+	// lists them as one line per directory and keeps their contents out
+	// of bundles.
+	Action string `json:"action"`
+}
+
+// mimeRules is set from the config.
+var mimeRules []MimeRule
+
+// currentMimeRules returns the mimeRules in effect.
+func currentMimeRules() []MimeRule {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return mimeRules
+}
+
+var (
+	mimeTypesMu sync.Mutex
+	mimeTypes   = make(map[checksumKey]string)
+)
+
+// sniffMime returns the content type of a file from its first 512 bytes,
+// without parameters, reusing the previous result while its size and
+// mtime are unchanged.
+func sniffMime(name string, size int64, modTime time.Time) string {
+	key := checksumKey{name, size, modTime}
+	mimeTypesMu.Lock()
+	mime, ok := mimeTypes[key]
+	mimeTypesMu.Unlock()
+	if ok {
+		return mime
+	}
+
+	mime = "application/octet-stream"
+	if f, err := fsys.Open(name); err == nil {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		f.Close()
+		mime, _, _ = strings.Cut(http.DetectContentType(head[:n]), ";")
+	}
+	mimeTypesMu.Lock()
+	mimeTypes[key] = mime
+	mimeTypesMu.Unlock()
+	return mime
+}
+
+// mimeAction returns the action of the first rule matching the file and
+// its sniffed type, or "" when no rule matches or none are configured.
+func mimeAction(name string, size int64, modTime time.Time) (action, mime string) {
+	rules := currentMimeRules()
+	if len(rules) == 0 {
+		return "", ""
+	}
+	mime = sniffMime(name, size, modTime)
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.Type, mime); ok {
+			return rule.Action, mime
+		}
+	}
+	return "", mime
+}
+
+// mimeGroupLine matches the lines written by mimeGroupLabels.
+var mimeGroupLine = regexp.MustCompile(`^[\w.+-]+/[\w.+*-]+: [\d,]+ files? \(`)
+
+// mimeGroupLabels summarizes a directory's summarized files by matching
+// rule, e.g. "image/*: 14 files (3.2 MB)".
+func mimeGroupLabels(nodes []*treeNode) []string {
+	counts := make(map[string]int)
+	sizes := make(map[string]int64)
+	rules := currentMimeRules()
+	for _, node := range nodes {
+		pattern := node.MimeType
+		for _, rule := range rules {
+			if ok, _ := path.Match(rule.Type, node.MimeType); ok {
+				pattern = rule.Type
+				break
+			}
+		}
+		counts[pattern]++
+		sizes[pattern] += node.Size
+	}
+	patterns := make([]string, 0, len(counts))
+	for pattern := range counts {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	labels := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		labels[i] = fmt.Sprintf("%s: %s %s (%s)", pattern, groupThousands(counts[pattern]), pluralNoun(counts[pattern], "file"), formatSize(sizes[pattern]))
+	}
+	return labels
+}
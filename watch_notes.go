@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Descriptions of paths from the config's notes, keyed by slash-separated
+// path relative to a root, or starting with the root as configured.
+var entryNotes map[string]string
+
+// Set by readmeNotes: directories without a note are described by their
+// README.md.
+var readmeNotes bool
+
+func setNotes(notes map[string]string, readmes bool) {
+	byPath := make(map[string]string, len(notes))
+	for p, note := range notes {
+		byPath[strings.Trim(path.Clean(strings.ReplaceAll(p, `\`, "/")), "/")] = note
+	}
+	settingsMu.Lock()
+	entryNotes, readmeNotes = byPath, readmes
+	settingsMu.Unlock()
+}
+
+// annotateNotes attaches the configured notes to the entries of tree,
+// and README descriptions to the directories without one.
+func annotateNotes(rootDir string, tree *treeNode) {
+	settingsMu.RLock()
+	notes, readmes := entryNotes, readmeNotes && !isRemoteRoot(rootDir)
+	settingsMu.RUnlock()
+	if len(notes) == 0 && !readmes {
+		return
+	}
+	prefix := strings.Trim(path.Clean(strings.ReplaceAll(rootDir, `\`, "/")), "/")
+	var walk func(node *treeNode, rel string)
+	walk = func(node *treeNode, rel string) {
+		for _, child := range node.Children {
+			p := path.Join(rel, child.Name)
+			if note, ok := notes[p]; ok {
+				child.Note = note
+			} else if note, ok := notes[path.Join(prefix, p)]; ok {
+				child.Note = note
+			} else if readmes && child.IsDir {
+				child.Note = readmeNote(filepath.Join(rootDir, filepath.FromSlash(p)), child)
+			}
+			walk(child, p)
+		}
+	}
+	walk(tree, "")
+}
+
+// noteSuffix is how a note trails its entry in the text output.
+const noteSuffix = "  # "
+
+// Longest README description shown, in runes.
+const maxReadmeNote = 80
+
+var (
+	readmeNotesMu   sync.Mutex
+	readmeNoteCache = make(map[checksumKey]string)
+)
+
+// readmeNote describes the directory node at dir by its README.md: the
+// first heading, or the first sentence after it when the heading only
+// repeats the directory's name.
+func readmeNote(dir string, node *treeNode) string {
+	var readme *treeNode
+	for _, child := range node.Children {
+		if !child.IsDir && strings.EqualFold(child.Name, "README.md") {
+			readme = child
+			break
+		}
+	}
+	if readme == nil {
+		return ""
+	}
+	key := checksumKey{filepath.Join(dir, readme.Name), readme.Size, readme.ModTime}
+	readmeNotesMu.Lock()
+	note, ok := readmeNoteCache[key]
+	readmeNotesMu.Unlock()
+	if ok {
+		return note
+	}
+	data, err := fsys.ReadFile(key.path)
+	if err != nil {
+		return ""
+	}
+	note = describeReadme(data, node.Name)
+	readmeNotesMu.Lock()
+	readmeNoteCache[key] = note
+	readmeNotesMu.Unlock()
+	return note
+}
+
+var (
+	markdownLink     = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	markdownEmphasis = strings.NewReplacer("**", "", "__", "", "`", "")
+	sentenceEnd      = regexp.MustCompile(`[.!?](\s|$)`)
+)
+
+func describeReadme(data []byte, dirName string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	inFrontMatter, inComment, inFence := false, false, false
+	var heading string
+	for line := 0; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == 0 && text == "---":
+			inFrontMatter = true
+			continue
+		case inFrontMatter:
+			inFrontMatter = text != "---"
+			continue
+		case inComment || strings.HasPrefix(text, "<!--"):
+			inComment = !strings.Contains(text, "-->")
+			continue
+		case strings.HasPrefix(text, "```"):
+			inFence = !inFence
+			continue
+		case inFence, text == "", strings.HasPrefix(text, "<"), strings.HasPrefix(text, "[!["), strings.HasPrefix(text, "!["):
+			continue
+		}
+
+		text = markdownEmphasis.Replace(markdownLink.ReplaceAllString(text, "$1"))
+		if strings.HasPrefix(text, "#") {
+			if heading != "" {
+				break
+			}
+			heading = strings.TrimSpace(strings.TrimLeft(text, "#"))
+			if !strings.EqualFold(heading, dirName) {
+				return shortenNote(heading)
+			}
+			continue
+		}
+		if loc := sentenceEnd.FindStringIndex(text); loc != nil {
+			text = text[:loc[0]+1]
+		}
+		return shortenNote(text)
+	}
+	return shortenNote(heading)
+}
+
+func shortenNote(s string) string {
+	if utf8.RuneCountInString(s) <= maxReadmeNote {
+		return s
+	}
+	return string([]rune(s)[:maxReadmeNote-1]) + "…"
+}
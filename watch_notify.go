@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// NotifyConfig limits when a notification sink may send. Held changes keep
+// accumulating and go out together once sending is allowed again.
+type NotifyConfig struct {
+	// Minimum time between two notifications, e.g. "1h".
+	Throttle Duration `json:"throttle,omitzero"`
+
+	// Local times, as "22:00" and "07:00", between which nothing is sent.
+	// The range may wrap past midnight.
+	QuietHours *QuietHours `json:"quietHours,omitempty"`
+}
+
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// notifyPolicy applies a NotifyConfig to one sink.
+type notifyPolicy struct {
+	config NotifyConfig
+	last   time.Time // Last notification sent
+}
+
+// delay returns how long to wait from now before sending.
+func (p *notifyPolicy) delay(now time.Time) time.Duration {
+	t := now
+	if throttle := p.config.Throttle.Duration; throttle > 0 && !p.last.IsZero() && t.Sub(p.last) < throttle {
+		t = p.last.Add(throttle)
+	}
+	if q := p.config.QuietHours; q != nil {
+		if end, quiet, err := q.until(t); err != nil {
+			log.Printf("Ignoring quiet hours: %v\n", err)
+		} else if quiet {
+			t = end
+		}
+	}
+	return t.Sub(now)
+}
+
+// sent records that a notification went out at t.
+func (p *notifyPolicy) sent(t time.Time) {
+	p.last = t
+}
+
+// until reports whether t falls within the quiet hours and, if so, when
+// they end.
+func (q QuietHours) until(t time.Time) (time.Time, bool, error) {
+	start, err := minuteOfDay(q.Start)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	end, err := minuteOfDay(q.End)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	now := t.Hour()*60 + t.Minute()
+	var quiet bool
+	if start <= end {
+		quiet = now >= start && now < end
+	} else {
+		quiet = now >= start || now < end
+	}
+	if !quiet {
+		return time.Time{}, false, nil
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	endTime := midnight.Add(time.Duration(end) * time.Minute)
+	if !endTime.After(t) {
+		endTime = endTime.AddDate(0, 0, 1)
+	}
+	return endTime, true, nil
+}
+
+func minuteOfDay(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
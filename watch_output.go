@@ -0,0 +1,669 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// OutputConfig describes one rendering of the trees and where it goes.
+type OutputConfig struct {
+	Format   string            `json:"format,omitempty"`   // "text" (default), "json", "jsonl", "csv", "tsv", "sha256" or "bundle"
+	Sink     string            `json:"sink,omitempty"`     // "file" (default), "fifo", "stdout", "http", "command" or "email"
+	Path     string            `json:"path,omitempty"`     // File or FIFO sink destination
+	URL      string            `json:"url,omitempty"`      // HTTP sink endpoint
+	Method   string            `json:"method,omitempty"`   // HTTP sink method, defaults to PUT
+	Headers  map[string]string `json:"headers,omitempty"`  // HTTP sink request headers
+	Command  []string          `json:"command,omitempty"`  // Command sink argv; output is fed on stdin
+	Compress bool              `json:"compress,omitempty"` // Gzip the output; file paths get a .gz suffix
+	Backups  int               `json:"backups,omitempty"`  // File sink: keep the previous file as Path.bak, or as Path.1 to Path.N when above 1
+	Mode     FileMode          `json:"mode,omitempty"`     // File permissions, e.g. "0664"; defaults to 0644
+	Group    string            `json:"group,omitempty"`    // Group name or id to give written files (Unix only)
+
+	// Largest output written, e.g. "20MB", so editors opening it don't
+	// lock up. Past it, overflow "truncate" (the default) cuts the output
+	// with a marker saying so; "rotate" continues it in numbered files,
+	// e.g. directory-trees.part2.txt. Either can leave JSON unparseable.
+	MaxOutputSize ByteSize `json:"maxOutputSize,omitempty"`
+	Overflow      string   `json:"overflow,omitempty"`
+
+	// Add each generation's output to the end of Path instead of
+	// overwriting it, for event-log-style jsonl or csv outputs. Once
+	// appending would take the file past RolloverSize, it is moved aside
+	// as Backups describes (Path.bak by default) and started afresh.
+	Append       bool     `json:"append,omitempty"`
+	RolloverSize ByteSize `json:"rolloverSize,omitempty"`
+
+	// Keep timestamped snapshots instead of overwriting Path.
+	History *HistoryConfig `json:"history,omitempty"`
+
+	// Text file output: also write its entries as gzipped JSONL to
+	// Path.jsonl.gz, which diff reads in place of the text while the text
+	// is unchanged. Notes, tags and shortened names can make the text
+	// ambiguous.
+	Entries bool `json:"entries,omitempty"`
+
+	// Email sink settings.
+	Email *EmailConfig `json:"email,omitempty"`
+
+	// Throttling and quiet hours for notification sinks such as email.
+	Notify NotifyConfig `json:"notify,omitzero"`
+}
+
+// Outputs used when the config doesn't list any: the text file plus a copy
+// on the console.
+var defaultOutputs = []OutputConfig{
+	{Format: "text", Sink: "file", Path: outputFileName},
+	{Format: "text", Sink: "stdout"},
+}
+
+// outputs returns the configured outputs or the defaults, with stdout
+// outputs added or dropped as the console setting asks.
+func (c Config) outputs() []OutputConfig {
+	outputs := c.Outputs
+	if len(outputs) == 0 {
+		outputs = defaultOutputs
+	}
+	if c.Console == nil {
+		return outputs
+	}
+	console := slices.IndexFunc(outputs, func(o OutputConfig) bool { return o.Sink == "stdout" })
+	switch {
+	case *c.Console && console < 0:
+		outputs = append(slices.Clip(outputs), OutputConfig{Format: "text", Sink: "stdout"})
+	case !*c.Console && console >= 0:
+		outputs = slices.DeleteFunc(slices.Clone(outputs), func(o OutputConfig) bool { return o.Sink == "stdout" })
+	}
+	return outputs
+}
+
+// generatedRoot is one watched root ready for rendering.
+type generatedRoot struct {
+	Dir     string
+	Tree    *treeNode
+	Summary string
+	Git     *watchapi.GitState // nil outside a git repository
+	Render  *RenderConfig      // Overrides the config's options for this root
+	Changes *treeChanges       // Since the previous generation; nil on the first
+	Union   []string           // Roots overlaid, for a union
+	Alias   string             // Shown in place of Dir when set
+	Group   string             // Header the root is presented under, if any
+}
+
+// outputSink delivers rendered output somewhere.
+type outputSink interface {
+	Write(data []byte) error
+	String() string
+}
+
+func newSink(o OutputConfig) (outputSink, error) {
+	if o.Append && o.Sink != "" && o.Sink != "file" {
+		return nil, fmt.Errorf("append needs a file output, not %q", o.Sink)
+	}
+	switch o.Sink {
+	case "", "file":
+		perms, err := outputPerms(o)
+		if err != nil {
+			return nil, err
+		}
+		path := o.Path
+		if path == "" {
+			path = outputFileName
+		}
+		if o.Append && o.History != nil {
+			return nil, fmt.Errorf("output %s can't both append and keep history", path)
+		}
+		if o.History != nil {
+			ext := filepath.Ext(o.Path)
+			if ext == "" {
+				ext = extensionFor(o.Format)
+			}
+			if o.Compress {
+				ext += ".gz"
+			}
+			return historySink{history: *o.History, ext: ext, perms: perms}, nil
+		}
+		if o.Compress && !strings.HasSuffix(path, ".gz") {
+			path += ".gz"
+		}
+		return fileSink{path: path, backups: o.Backups, perms: perms, append: o.Append, rollover: int64(o.RolloverSize)}, nil
+	case "fifo":
+		if o.Path == "" {
+			return nil, fmt.Errorf("fifo sink needs a path")
+		}
+		perms, err := outputPerms(o)
+		if err != nil {
+			return nil, err
+		}
+		return fifoSink{path: o.Path, perms: perms}, nil
+	case "stdout":
+		return stdoutSink{}, nil
+	case "http":
+		if o.URL == "" {
+			return nil, fmt.Errorf("http sink needs a url")
+		}
+		method := o.Method
+		if method == "" {
+			method = http.MethodPut
+		}
+		return httpSink{url: o.URL, method: method, headers: o.Headers, contentType: contentTypeFor(o.Format), gzip: o.Compress}, nil
+	case "command":
+		if len(o.Command) == 0 {
+			return nil, fmt.Errorf("command sink needs a command")
+		}
+		return commandSink{argv: o.Command}, nil
+	case "email":
+		if o.Email == nil || o.Email.Server == "" || len(o.Email.To) == 0 {
+			return nil, fmt.Errorf("email sink needs a server and recipients")
+		}
+		return emailSink{config: *o.Email, notify: o.Notify}, nil
+	}
+	return nil, fmt.Errorf("unknown sink %q", o.Sink)
+}
+
+type fileSink struct {
+	path     string
+	backups  int
+	perms    filePerms
+	append   bool
+	rollover int64
+}
+
+func (s fileSink) Write(data []byte) error {
+	if s.append {
+		return s.appendData(data)
+	}
+	if s.backups > 0 {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("backing up %s: %w", s.path, err)
+		}
+	}
+	return s.perms.writeFile(s.path, data)
+}
+
+// rotate moves the current file aside before it is overwritten, shifting
+// older numbered backups up by one and dropping the oldest.
+func (s fileSink) rotate() error {
+	if _, err := os.Stat(s.path); err != nil {
+		return nil
+	}
+	if s.backups == 1 {
+		return os.Rename(s.path, s.path+".bak")
+	}
+	for i := s.backups - 1; i >= 1; i-- {
+		older := fmt.Sprintf("%s.%d", s.path, i)
+		if _, err := os.Stat(older); err == nil {
+			if err := os.Rename(older, fmt.Sprintf("%s.%d", s.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(s.path, s.path+".1")
+}
+
+// appendData adds data to the file, first rolling it over if that would
+// take it past the rollover size.
+func (s fileSink) appendData(data []byte) error {
+	if info, err := os.Stat(s.path); err == nil && s.rollover > 0 && info.Size() > 0 && info.Size()+int64(len(data)) > s.rollover {
+		rolled := s
+		rolled.backups = max(s.backups, 1)
+		if err := rolled.rotate(); err != nil {
+			return fmt.Errorf("rolling over %s: %w", s.path, err)
+		}
+	}
+	return s.perms.appendFile(s.path, data)
+}
+
+func (s fileSink) String() string { return s.path }
+
+type stdoutSink struct{}
+
+func (stdoutSink) Write(data []byte) error {
+	if !printTrees {
+		return nil
+	}
+	consoleStatus.clear()
+	_, err := fmt.Println(string(data))
+	return err
+}
+
+func (stdoutSink) String() string { return "stdout" }
+
+type httpSink struct {
+	url         string
+	method      string
+	headers     map[string]string
+	contentType string
+	gzip        bool
+}
+
+func (s httpSink) Write(data []byte) error {
+	req, err := http.NewRequest(s.method, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.contentType)
+	if s.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s", s.method, s.url, resp.Status)
+	}
+	return nil
+}
+
+func (s httpSink) String() string { return s.method + " " + s.url }
+
+type commandSink struct {
+	argv []string
+}
+
+func (s commandSink) Write(data []byte) error {
+	cmd := exec.Command(s.argv[0], s.argv[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = childStdout()
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (s commandSink) String() string { return strings.Join(s.argv, " ") }
+
+func contentTypeFor(format string) string {
+	switch format {
+	case "json":
+		return "application/json"
+	case "jsonl":
+		return "application/x-ndjson"
+	case "csv":
+		return "text/csv; charset=utf-8"
+	case "tsv":
+		return "text/tab-separated-values; charset=utf-8"
+	case "bundle":
+		return "text/markdown; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+func extensionFor(format string) string {
+	switch format {
+	case "json":
+		return ".json"
+	case "jsonl":
+		return ".jsonl"
+	case "csv":
+		return ".csv"
+	case "tsv":
+		return ".tsv"
+	case "sha256":
+		return ".sha256"
+	case "bundle":
+		return ".md"
+	}
+	return ".txt"
+}
+
+func formatName(format string) string {
+	if format == "" {
+		return "text"
+	}
+	return format
+}
+
+// render produces the bytes for one output format.
+func render(format string, roots []generatedRoot, opts RenderConfig) ([]byte, error) {
+	switch format {
+	case "text":
+		return []byte(renderText(roots, opts)), nil
+	case "json":
+		return renderJSON(roots)
+	case "jsonl":
+		return renderJSONL(roots, opts)
+	case "csv":
+		return renderCSV(roots, opts, ',')
+	case "tsv":
+		return renderCSV(roots, opts, '\t')
+	case "sha256":
+		return renderManifest(roots), nil
+	case "bundle":
+		return []byte(renderBundle(roots, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func renderText(roots []generatedRoot, opts RenderConfig) string {
+	var builder strings.Builder
+	builder.WriteString(outputHeader())
+	sections, err := opts.Sections.parse()
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		sections, _ = SectionConfig{}.parse()
+	}
+	now := time.Now()
+	group := ""
+	for i, root := range roots {
+		data := newSectionData(roots, i, now)
+		if root.Group != group {
+			group = root.Group
+			if group != "" {
+				executeSection(&builder, sections.group, data)
+			}
+		}
+		executeSection(&builder, sections.header, data)
+		rootOpts := opts
+		if root.Render != nil {
+			rootOpts = *root.Render
+			rootOpts.color = opts.color
+		}
+		if rootOpts.ChangeMarkers {
+			rootOpts.changes = root.Changes
+		}
+		if root.Union != nil {
+			builder.WriteString(renderUnion(root, rootOpts))
+		} else {
+			builder.WriteString(renderTree(root, rootOpts))
+		}
+		if root.Summary != "" {
+			builder.WriteString("\n")
+			builder.WriteString(redactText(root.Summary))
+		}
+		executeSection(&builder, sections.separator, data)
+	}
+	return builder.String()
+}
+
+// Hash of the output each sink last received, keyed by sink and format,
+// so generations that change nothing aren't written again.
+var (
+	lastWrittenMu sync.Mutex
+	lastWritten   = make(map[string][sha256.Size]byte)
+)
+
+// writeOutputs renders roots once per format and hands the result to every
+// configured sink whose output changed since its last write. Failures are
+// logged per output.
+func writeOutputs(outputs []OutputConfig, opts RenderConfig, roots []generatedRoot) {
+	rendered := make(map[string][]byte)
+	for _, o := range outputs {
+		sink, err := newSink(o)
+		if err != nil {
+			log.Printf("Error configuring output: %v\n", err)
+			continue
+		}
+		format := formatName(o.Format)
+		if _, ok := sink.(emailSink); ok {
+			format = "jsonl" // Digests are built from the entries, not the text
+		}
+		data, ok := rendered[format]
+		if _, isStdout := sink.(stdoutSink); isStdout && format == "text" && opts.useColor() {
+			colored := opts
+			colored.color = true
+			data, ok = []byte(renderText(roots, colored)), true
+		}
+		if !ok {
+			data, err = render(format, roots, opts)
+			if err != nil {
+				log.Printf("Error rendering %s output: %v\n", format, err)
+				continue
+			}
+			rendered[format] = data
+		}
+
+		var parts [][]byte
+		data, parts = limitOutput(o, sink.String(), data)
+		_, isStdout := sink.(stdoutSink)
+		compress := o.Compress && !isStdout
+
+		// An entries file is rewritten whenever its text is, so sizes and
+		// mtimes the text doesn't show count too.
+		fs, isFile := sink.(fileSink)
+		var entries []byte
+		if isFile && o.Entries {
+			if entries, err = renderJSONL(roots, opts); err != nil {
+				log.Printf("Error rendering the entries of %s: %v\n", sink, err)
+				continue
+			}
+		}
+
+		// Hashed as the sink receives it, so a change to the size limit or
+		// compression is written out too.
+		key := sink.String() + "\x00" + format
+		sum := outputHash(format, compress, data, append(parts, entries))
+		lastWrittenMu.Lock()
+		previous, seen := lastWritten[key]
+		lastWrittenMu.Unlock()
+		if seen && previous == sum && !outputMissing(sink) {
+			continue
+		}
+
+		if compress {
+			data, err = gzipBytes(data)
+			if err != nil {
+				log.Printf("Error compressing output for %s: %v\n", sink, err)
+				continue
+			}
+		}
+
+		if err := sink.Write(data); errors.Is(err, errNoReader) {
+			tracef("Skipping %s: %v\n", sink, err)
+			continue
+		} else if err != nil {
+			log.Printf("Error writing to %s: %v\n", sink, err)
+			continue
+		}
+		if isFile && o.Overflow == "rotate" {
+			if err := fs.writeParts(parts); err != nil {
+				log.Printf("Error writing the parts of %s: %v\n", sink, err)
+				continue
+			}
+		}
+		if entries != nil {
+			if err := fs.writeEntries(data, entries); err != nil {
+				log.Printf("Error writing the entries of %s: %v\n", sink, err)
+				continue
+			}
+		}
+		lastWrittenMu.Lock()
+		lastWritten[key] = sum
+		lastWrittenMu.Unlock()
+		if _, quiet := sink.(stdoutSink); !quiet {
+			log.Printf("Successfully updated %s\n", sink)
+		}
+	}
+}
+
+// generatedAtLine matches the timestamp of the JSON output, which changes
+// on every generation.
+var generatedAtLine = regexp.MustCompile(`(?m)^  "generatedAt": ".*",$`)
+
+// outputHash digests output as written, before compression, leaving out
+// the JSON timestamp. parts are what is written with it: the continuation
+// files of a rotated output and the entries file; nil ones are skipped.
+func outputHash(format string, compress bool, data []byte, parts [][]byte) [sha256.Size]byte {
+	if format == "json" {
+		data = generatedAtLine.ReplaceAll(data, nil)
+	}
+	parts = slices.DeleteFunc(parts, func(part []byte) bool { return part == nil })
+	if !compress && len(parts) == 0 {
+		return sha256.Sum256(data)
+	}
+	h := sha256.New()
+	if compress {
+		h.Write([]byte("gzip\x00"))
+	}
+	h.Write(data)
+	for _, part := range parts {
+		h.Write([]byte{0})
+		h.Write(part)
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// outputMissing reports whether a file output was deleted since it was
+// written, so it is recreated even though nothing changed.
+func outputMissing(sink outputSink) bool {
+	s, ok := sink.(fileSink)
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(s.path)
+	return err != nil
+}
+
+// validate checks the outputs, including the workspaces', the section
+// templates and the API's TLS certificate.
+func (c Config) validate() []error {
+	errs := validateOutputs(slices.Concat(c.outputs(), c.Workspaces.allOutputs()))
+	if err := c.Render.Sections.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Listen != "" && c.Server.TLS.CertFile != "" {
+		if _, err := c.Server.TLS.certificate(); err != nil {
+			errs = append(errs, fmt.Errorf("loading TLS certificate %s: %w", c.Server.TLS.CertFile, err))
+		}
+	}
+	return errs
+}
+
+// validateOutputs checks that every output is well-formed and that file
+// and history destinations can be written, so a bad path fails at startup
+// instead of on every generation. Workspace paths with placeholders are
+// only checked once expanded, when they are written.
+func validateOutputs(outputs []OutputConfig) []error {
+	var errs []error
+	for _, o := range outputs {
+		sink, err := newSink(o)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := o.checkSizeLimit(sink); err != nil {
+			errs = append(errs, err)
+		}
+		if _, isFile := sink.(fileSink); o.Entries && (!isFile || formatName(o.Format) != "text" || o.Append) {
+			errs = append(errs, fmt.Errorf("entries needs a text file output that isn't appended to"))
+		}
+		switch sink := sink.(type) {
+		case fileSink:
+			if strings.Contains(sink.path, "{workspace}") {
+				continue
+			}
+			if err := checkWritableFile(sink.path); err != nil {
+				errs = append(errs, fmt.Errorf("output %s is not writable: %w", sink.path, err))
+			}
+		case historySink:
+			if err := checkWritableDir(sink.history.dir(), true); err != nil {
+				errs = append(errs, fmt.Errorf("snapshot directory %s is not writable: %w", sink.history.dir(), err))
+			}
+		}
+	}
+	return errs
+}
+
+// checkWritableFile reports whether path can be created or overwritten
+// without changing it.
+func checkWritableFile(path string) error {
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("is a directory")
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	return checkWritableDir(filepath.Dir(path), false)
+}
+
+// checkWritableDir creates and removes a scratch file in dir. When create
+// is set a missing dir is fine as long as its nearest existing parent is
+// writable, since the sink creates it.
+func checkWritableDir(dir string, create bool) error {
+	for create {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	f, err := os.CreateTemp(dir, ".watch-check-*")
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("directory %s does not exist", dir)
+	} else if err != nil {
+		return fmt.Errorf("cannot create files in %s: %w", dir, errors.Unwrap(err))
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// outputIgnores returns the ignoreList entries keeping file outputs out of
+// the trees they are part of. Workspace outputs are ignored by pattern,
+// "{workspace}" matching any name.
+func outputIgnores(config Config) []string {
+	var ignores []string
+	for _, o := range slices.Concat(config.outputs(), config.Workspaces.allOutputs()) {
+		sink, err := newSink(o)
+		if err != nil {
+			continue
+		}
+		switch sink := sink.(type) {
+		case fileSink:
+			base := strings.ReplaceAll(filepath.Base(sink.path), "{workspace}", "*")
+			if sink.path != outputFileName {
+				ignores = append(ignores, base)
+			}
+			if o.Entries {
+				ignores = append(ignores, base+entriesSuffix)
+			}
+			if sink.backups > 0 || sink.rollover > 0 {
+				ignores = append(ignores, base+".bak", base+".[0-9]*")
+			}
+			if o.Overflow == "rotate" {
+				ext := filepath.Ext(base)
+				ignores = append(ignores, strings.TrimSuffix(base, ext)+".part[0-9]*"+ext)
+			}
+		case historySink:
+			ignores = append(ignores, filepath.Base(sink.history.dir()))
+		case fifoSink:
+			ignores = append(ignores, filepath.Base(sink.path))
+		}
+	}
+	return ignores
+}
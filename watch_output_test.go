@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// forgetWrittenOutputs clears the hashes of written outputs after the test.
+func forgetWrittenOutputs(t *testing.T) {
+	t.Cleanup(func() {
+		lastWrittenMu.Lock()
+		clear(lastWritten)
+		lastWrittenMu.Unlock()
+	})
+}
+
+func TestWriteOutputsHashesWhatIsWritten(t *testing.T) {
+	forgetWrittenOutputs(t)
+	tree := &treeNode{Name: "src", IsDir: true}
+	for _, name := range []string{"checkout.ts", "products.ts", "wicks.ts"} {
+		tree.Children = append(tree.Children, &treeNode{Name: name, Size: 10})
+	}
+	roots := []generatedRoot{{Dir: "src", Tree: tree}}
+	o := OutputConfig{Path: filepath.Join(t.TempDir(), "trees.txt")}
+
+	writeOutputs([]OutputConfig{o}, RenderConfig{}, roots)
+
+	// Only the redaction changes: the tree is the same, the file isn't.
+	enableRedaction(map[string]string{"wicks": ""})
+	t.Cleanup(func() { redactor = nil })
+	writeOutputs([]OutputConfig{o}, RenderConfig{}, roots)
+	redacted, err := os.ReadFile(o.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(redacted), "[redacted].ts") {
+		t.Errorf("output after enabling redaction:\n%s\nwant wicks.ts redacted", redacted)
+	}
+
+	// Only the size limit changes.
+	o.MaxOutputSize = ByteSize(len(redacted) - 1)
+	writeOutputs([]OutputConfig{o}, RenderConfig{}, roots)
+	limited, err := os.ReadFile(o.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(limited), "truncated") {
+		t.Errorf("output after lowering maxOutputSize:\n%s\nwant it truncated", limited)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Smallest maxOutputSize accepted, leaving room for the overflow marker.
+const minOutputSize = 1 << 10
+
+// checkSizeLimit reports a maxOutputSize or overflow setting the output
+// can't honor.
+func (o OutputConfig) checkSizeLimit(sink outputSink) error {
+	switch o.Overflow {
+	case "", "truncate":
+	case "rotate":
+		if _, ok := sink.(fileSink); !ok || o.Compress || o.Append {
+			return fmt.Errorf("overflow \"rotate\" needs an uncompressed file output that isn't appended to, not %s", sink)
+		}
+	default:
+		return fmt.Errorf("unknown overflow %q for %s", o.Overflow, sink)
+	}
+	if o.MaxOutputSize != 0 && o.MaxOutputSize < minOutputSize {
+		return fmt.Errorf("maxOutputSize for %s must be at least %s", sink, formatSize(minOutputSize))
+	}
+	return nil
+}
+
+// limitOutput applies o's maxOutputSize to rendered output. With overflow
+// "rotate" it returns what goes to the sink and the continuation parts
+// for partPath; otherwise it truncates. Cuts fall on line boundaries when
+// possible.
+func limitOutput(o OutputConfig, path string, data []byte) (first []byte, parts [][]byte) {
+	limit := int(o.MaxOutputSize)
+	if limit <= 0 || len(data) <= limit {
+		return data, nil
+	}
+	if o.Overflow != "rotate" {
+		marker := fmt.Sprintf("\n… truncated: the output is %s, over the maxOutputSize of %s\n",
+			formatSize(int64(len(data))), formatSize(int64(limit)))
+		return append(cutAtLine(data, limit-len(marker)), marker...), nil
+	}
+	for n := 1; len(data) > 0; n++ {
+		if len(data) <= limit {
+			parts = append(parts, data)
+			break
+		}
+		marker := fmt.Sprintf("\n… continued in %s\n", filepath.Base(partPath(path, n+1)))
+		part := cutAtLine(data, limit-len(marker))
+		data = data[len(part):]
+		parts = append(parts, append(part, marker...))
+	}
+	return parts[0], parts[1:]
+}
+
+// cutAtLine returns the longest prefix of data within size bytes that
+// ends a line, or exactly size bytes when the first line is longer.
+func cutAtLine(data []byte, size int) []byte {
+	if i := bytes.LastIndexByte(data[:size], '\n'); i >= 0 {
+		size = i + 1
+	}
+	return bytes.Clone(data[:size])
+}
+
+// partPath names the n-th part of a rotated output, counting path as the
+// first: "directory-trees.txt" continues in "directory-trees.part2.txt".
+func partPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".part" + strconv.Itoa(n) + ext
+}
+
+// writeParts writes the continuation parts of a rotated output and
+// removes those left from a longer output.
+func (s fileSink) writeParts(parts [][]byte) error {
+	for i, part := range parts {
+		if err := s.perms.writeFile(partPath(s.path, i+2), part); err != nil {
+			return err
+		}
+	}
+	for n := len(parts) + 2; ; n++ {
+		err := os.Remove(partPath(s.path, n))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
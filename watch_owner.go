@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/fs"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fileOwner is the numeric owner of a local file.
+type fileOwner struct {
+	UID, GID int
+}
+
+var (
+	ownerNamesMu sync.Mutex
+	ownerNames   = make(map[fileOwner]string)
+)
+
+// name returns "user:group", falling back to the numeric ids for users
+// and groups that don't resolve.
+func (o fileOwner) name() string {
+	ownerNamesMu.Lock()
+	defer ownerNamesMu.Unlock()
+	if name, ok := ownerNames[o]; ok {
+		return name
+	}
+	userName := strconv.Itoa(o.UID)
+	if u, err := user.LookupId(userName); err == nil {
+		userName = u.Username
+	}
+	groupName := strconv.Itoa(o.GID)
+	if g, err := user.LookupGroupId(groupName); err == nil {
+		groupName = g.Name
+	}
+	name := userName + ":" + groupName
+	ownerNames[o] = name
+	return name
+}
+
+// entryMetadataSuffix matches what entryMetadata adds to a text entry.
+var entryMetadataSuffix = regexp.MustCompile(` \[(?:[-a-zA-Z]{10}(?: [^\s\[\]]+:[^\s\[\]]+)?|[^\s\[\]]+:[^\s\[\]]+)\]$`)
+
+// entryMetadata returns the permission bits and owner of node that the
+// Permissions and Owner options ask for, e.g. "-rw-r--r-- www-data:www".
+func (opts RenderConfig) entryMetadata(node *treeNode) string {
+	var parts []string
+	if opts.Permissions && node.Mode != 0 {
+		parts = append(parts, lsMode(node.Mode))
+	}
+	if opts.Owner && node.Owner != nil {
+		parts = append(parts, node.Owner.name())
+	}
+	return strings.Join(parts, " ")
+}
+
+// lsMode formats mode as ls -l does, e.g. "drwxr-xr-x" or "-rwsr-xr-x",
+// rather than Go's "urwxr-xr-x" for setuid.
+func lsMode(mode fs.FileMode) string {
+	b := []byte("-rwxrwxrwx")
+	switch {
+	case mode.IsDir():
+		b[0] = 'd'
+	case mode&fs.ModeSymlink != 0:
+		b[0] = 'l'
+	case mode&fs.ModeNamedPipe != 0:
+		b[0] = 'p'
+	case mode&fs.ModeSocket != 0:
+		b[0] = 's'
+	case mode&fs.ModeCharDevice != 0:
+		b[0] = 'c'
+	case mode&fs.ModeDevice != 0:
+		b[0] = 'b'
+	}
+	for i := range 9 {
+		if mode&(1<<(8-i)) == 0 {
+			b[i+1] = '-'
+		}
+	}
+	special := func(i int, set bool, lower, upper byte) {
+		if !set {
+			return
+		}
+		if b[i] == '-' {
+			b[i] = upper
+		} else {
+			b[i] = lower
+		}
+	}
+	special(3, mode&fs.ModeSetuid != 0, 's', 'S')
+	special(6, mode&fs.ModeSetgid != 0, 's', 'S')
+	special(9, mode&fs.ModeSticky != 0, 't', 'T')
+	return string(b)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// ownerOf returns nil: files have no POSIX owner here.
+func ownerOf(info fs.FileInfo) *fileOwner {
+	return nil
+}
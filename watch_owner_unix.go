@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// ownerOf returns the owner of a file, or nil when info doesn't come from
+// the operating system.
+func ownerOf(info fs.FileInfo) *fileOwner {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return &fileOwner{UID: int(st.Uid), GID: int(st.Gid)}
+	}
+	return nil
+}
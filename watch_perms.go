@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+)
+
+// FileMode is a permission mode written in the config file as an octal
+// string like "0664".
+type FileMode os.FileMode
+
+func (m FileMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%04o", uint32(m)))
+}
+
+func (m *FileMode) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("mode must be an octal string like \"0664\"")
+	}
+	value, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || value > 0777 {
+		return fmt.Errorf("invalid mode %q", s)
+	}
+	*m = FileMode(value)
+	return nil
+}
+
+// filePerms is the mode and group given to written output files. Without
+// a configured mode files are created 0644, subject to the umask, and
+// existing files keep theirs; gid is -1 to leave the group alone.
+type filePerms struct {
+	mode os.FileMode
+	gid  int
+}
+
+// outputPerms resolves an output's mode and group, the group given by name
+// or number.
+func outputPerms(o OutputConfig) (filePerms, error) {
+	perms := filePerms{mode: os.FileMode(o.Mode), gid: -1}
+	if o.Group == "" {
+		return perms, nil
+	}
+	if runtime.GOOS == "windows" {
+		return perms, fmt.Errorf("output group is not supported on Windows")
+	}
+	if gid, err := strconv.Atoi(o.Group); err == nil {
+		perms.gid = gid
+		return perms, nil
+	}
+	group, err := user.LookupGroup(o.Group)
+	if err != nil {
+		return perms, err
+	}
+	perms.gid, _ = strconv.Atoi(group.Gid)
+	return perms, nil
+}
+
+// writeFile writes data to path and applies the configured permissions.
+// The mode is set explicitly so the umask doesn't strip group write.
+func (p filePerms) writeFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	return p.apply(path)
+}
+
+// appendFile adds data to the end of path, creating it if needed.
+func (p filePerms) appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return p.apply(path)
+}
+
+func (p filePerms) apply(path string) error {
+	if p.mode != 0 {
+		if err := os.Chmod(path, p.mode); err != nil {
+			return err
+		}
+	}
+	if p.gid >= 0 {
+		return os.Chown(path, -1, p.gid)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"runtime/trace"
+)
+
+// profileFlags are the --cpuprofile, --memprofile and --trace options
+// shared by the watcher and the one-shot commands.
+type profileFlags struct {
+	cpu, mem, trace *string
+}
+
+func addProfileFlags(fs *flag.FlagSet) profileFlags {
+	return profileFlags{
+		cpu:   fs.String("cpuprofile", "", "Write a CPU profile to this file"),
+		mem:   fs.String("memprofile", "", "Write a heap profile to this file on exit"),
+		trace: fs.String("trace", "", "Write an execution trace to this file"),
+	}
+}
+
+// start begins the requested profiles and returns a function that
+// finishes them; it must run before the process exits.
+func (p profileFlags) start() (stop func()) {
+	var stops []func()
+	if *p.cpu != "" {
+		f, err := os.Create(*p.cpu)
+		if err != nil {
+			log.Fatalf("Error creating %s: %v", *p.cpu, err)
+		}
+		if err := runtimepprof.StartCPUProfile(f); err != nil {
+			log.Fatalf("Error starting CPU profile: %v", err)
+		}
+		stops = append(stops, func() {
+			runtimepprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+	if *p.trace != "" {
+		f, err := os.Create(*p.trace)
+		if err != nil {
+			log.Fatalf("Error creating %s: %v", *p.trace, err)
+		}
+		if err := trace.Start(f); err != nil {
+			log.Fatalf("Error starting trace: %v", err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			f.Close()
+		})
+	}
+	if *p.mem != "" {
+		stops = append(stops, func() {
+			f, err := os.Create(*p.mem)
+			if err != nil {
+				log.Printf("Error creating %s: %v\n", *p.mem, err)
+				return
+			}
+			defer f.Close()
+			runtime.GC()
+			if err := runtimepprof.WriteHeapProfile(f); err != nil {
+				log.Printf("Error writing heap profile: %v\n", err)
+			}
+		})
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// handlePprof mounts the net/http/pprof endpoints under /debug/pprof/.
+func handlePprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
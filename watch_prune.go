@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// pruneCandidate is a directory whose contents may be dropped.
+type pruneCandidate struct {
+	node   *treeNode
+	path   string
+	depth  int
+	newest time.Time // Latest mtime in the subtree
+}
+
+// pruneToNodeCap drops the contents of directories until the roots
+// together hold at most limit nodes, the deepest and least recently
+// modified subtrees first. Emptied directories are marked with what they
+// held, and a summary of the pruning is logged. The trees of roots are
+// left alone: when anything is pruned, the returned roots hold copies.
+func pruneToNodeCap(roots []generatedRoot, limit int) []generatedRoot {
+	if limit <= 0 {
+		return roots
+	}
+	total := 0
+	for _, root := range roots {
+		total += countNodes(root.Tree)
+	}
+	if total <= limit {
+		return roots
+	}
+
+	roots = slices.Clone(roots)
+	var candidates []pruneCandidate
+	for i := range roots {
+		roots[i].Tree = cloneTree(roots[i].Tree)
+		for _, child := range roots[i].Tree.Children {
+			collectPruneCandidates(child, filepath.Join(roots[i].Dir, child.Name), 1, &candidates)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].depth != candidates[j].depth {
+			return candidates[i].depth > candidates[j].depth
+		}
+		return candidates[i].newest.Before(candidates[j].newest)
+	})
+	var pruned []string
+	removed := 0
+	for _, c := range candidates {
+		if total <= limit {
+			break
+		}
+		if len(c.node.Children) == 0 {
+			continue
+		}
+		files, dirs := 0, 0
+		if c.node.Pruned != nil {
+			files, dirs = c.node.Pruned.Files, c.node.Pruned.Dirs
+		}
+		for _, child := range c.node.Children {
+			n := countNodes(child)
+			total -= n
+			removed += n
+			f, d := countEntries(child)
+			files, dirs = files+f, dirs+d
+		}
+		c.node.Children = nil
+		c.node.Pruned = &watchapi.Pruned{Files: files, Dirs: dirs}
+		pruned = append(pruned, filepath.ToSlash(c.path))
+	}
+
+	examples := pruned
+	if len(examples) > 5 {
+		examples = examples[:5]
+	}
+	log.Printf("Node cap of %d exceeded: pruned %d entries from %d directories, e.g. %s\n", limit, removed, len(pruned), strings.Join(examples, ", "))
+	if total > limit {
+		log.Printf("Output still has %d nodes after pruning every directory\n", total)
+	}
+	return roots
+}
+
+func collectPruneCandidates(node *treeNode, path string, depth int, out *[]pruneCandidate) time.Time {
+	newest := node.ModTime
+	if !node.IsDir {
+		return newest
+	}
+	for _, child := range node.Children {
+		if t := collectPruneCandidates(child, filepath.Join(path, child.Name), depth+1, out); t.After(newest) {
+			newest = t
+		}
+	}
+	*out = append(*out, pruneCandidate{node: node, path: path, depth: depth, newest: newest})
+	return newest
+}
+
+// countNodes counts node and everything beneath it.
+func countNodes(node *treeNode) int {
+	n := 1
+	for _, child := range node.Children {
+		n += countNodes(child)
+	}
+	return n
+}
+
+// countEntries counts the files and directories node stands for,
+// including what earlier pruning removed beneath it.
+func countEntries(node *treeNode) (files, dirs int) {
+	if !node.IsDir {
+		return 1, 0
+	}
+	dirs = 1
+	if node.Pruned != nil {
+		files, dirs = files+node.Pruned.Files, dirs+node.Pruned.Dirs
+	}
+	for _, child := range node.Children {
+		f, d := countEntries(child)
+		files, dirs = files+f, dirs+d
+	}
+	return files, dirs
+}
+
+// prunedLabel is the line standing in for a pruned directory's contents.
+func prunedLabel(p *watchapi.Pruned, ellipsis string) string {
+	return fmt.Sprintf("%s (%s %s in %s %s, pruned)", ellipsis, groupThousands(p.Files), pluralNoun(p.Files, "file"), groupThousands(p.Dirs), pluralNoun(p.Dirs, "dir"))
+}
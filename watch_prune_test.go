@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestPruneToNodeCapCopies(t *testing.T) {
+	deep := &treeNode{Name: "lib", IsDir: true, Children: []*treeNode{{Name: "a.ts"}, {Name: "b.ts"}, {Name: "c.ts"}}}
+	tree := &treeNode{Name: "src", IsDir: true, Children: []*treeNode{deep, {Name: "index.ts"}}}
+	roots := []generatedRoot{{Dir: "src", Tree: tree}}
+
+	pruned := pruneToNodeCap(roots, 3)
+	if len(deep.Children) != 3 || deep.Pruned != nil {
+		t.Errorf("original tree was pruned: %+v", deep)
+	}
+	if roots[0].Tree != tree {
+		t.Error("the roots passed in were changed")
+	}
+	lib := pruned[0].Tree.Children[0]
+	if len(lib.Children) != 0 || lib.Pruned == nil || lib.Pruned.Files != 3 {
+		t.Errorf("pruned copy of lib = %+v, want its 3 files pruned", lib)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// changeBatch is what one settled burst of events changed.
+type changeBatch struct {
+	// Changed paths, true if any of their events changed the tree's
+	// structure.
+	changed map[string]bool
+	renames []renamePair
+	// Repositories whose HEAD or branch refs moved.
+	movedRepos map[string]bool
+}
+
+func newChangeBatch() changeBatch {
+	return changeBatch{changed: make(map[string]bool), movedRepos: make(map[string]bool)}
+}
+
+func (b changeBatch) empty() bool {
+	return len(b.changed) == 0 && len(b.movedRepos) == 0
+}
+
+// structural reports whether the batch calls for a regeneration: a path
+// changed the tree's structure or a repository's refs moved.
+func (b changeBatch) structural() bool {
+	if len(b.movedRepos) > 0 {
+		return true
+	}
+	for _, structural := range b.changed {
+		if structural {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *changeBatch) merge(other changeBatch) {
+	for path, structural := range other.changed {
+		b.changed[path] = b.changed[path] || structural
+	}
+	b.renames = append(b.renames, other.renames...)
+	for gitDir := range other.movedRepos {
+		b.movedRepos[gitDir] = true
+	}
+}
+
+// isStructural reports whether an event in root can change the tree
+// rather than only a file's contents.
+func isStructural(event fsnotify.Event, root string) bool {
+	fileRootChanged := root == event.Name && event.Has(fsnotify.Write)
+	// Edits to ignore files change what the tree contains.
+	rulesChanged := isIgnoreFile(event.Name) || filepath.Base(event.Name) == ".gitattributes"
+	return event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) || fileRootChanged || rulesChanged
+}
+
+// Batches held before new ones are folded into the newest.
+const changeQueueSize = 64
+
+// changeQueue carries settled batches from the goroutine reading watcher
+// events to the worker that updates the index and logs and requests
+// generations, so slow work never stops events being read. push never
+// blocks: once the queue is full, batches are merged into the last one.
+type changeQueue struct {
+	mu      sync.Mutex
+	batches []changeBatch
+	ready   chan struct{}
+	busy    bool       // The worker is handling a batch
+	idle    *sync.Cond // Signaled when the worker finishes one
+}
+
+func newChangeQueue() *changeQueue {
+	q := &changeQueue{ready: make(chan struct{}, 1)}
+	q.idle = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *changeQueue) push(b changeBatch) {
+	q.mu.Lock()
+	if len(q.batches) >= changeQueueSize {
+		q.batches[len(q.batches)-1].merge(b)
+	} else {
+		q.batches = append(q.batches, b)
+	}
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for batches and returns everything queued merged into one.
+// The worker calls done once it has handled it.
+func (q *changeQueue) next() changeBatch {
+	for {
+		<-q.ready
+		q.mu.Lock()
+		batches := q.batches
+		q.batches = nil
+		q.busy = len(batches) > 0
+		q.mu.Unlock()
+		if len(batches) == 0 {
+			continue
+		}
+		merged := newChangeBatch()
+		for _, b := range batches {
+			merged.merge(b)
+		}
+		return merged
+	}
+}
+
+// done marks the batch last returned by next as handled.
+func (q *changeQueue) done() {
+	q.mu.Lock()
+	q.busy = false
+	q.mu.Unlock()
+	q.idle.Broadcast()
+}
+
+// wait blocks until every queued batch has been handled.
+func (q *changeQueue) wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.busy || len(q.batches) > 0 {
+		q.idle.Wait()
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig limits how often each client may call the tree
+// endpoints. GET /trees, POST /trees and POST /regenerate share one budget
+// per client. Requests beyond the limit get 429 Too Many Requests.
+type RateLimitConfig struct {
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty"`
+	Burst             int `json:"burst,omitempty"` // Defaults to RequestsPerMinute
+}
+
+// How often buckets that have refilled are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter is a token bucket per client IP.
+type rateLimiter struct {
+	rate  float64 // Tokens per second
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns nil when config sets no limit.
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	if config.RequestsPerMinute <= 0 {
+		return nil
+	}
+	burst := config.Burst
+	if burst <= 0 {
+		burst = config.RequestsPerMinute
+	}
+	return &rateLimiter{
+		rate:    float64(config.RequestsPerMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from client's bucket. When the bucket is empty it
+// returns how long until the next token.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.buckets[client]
+	if b == nil {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// evictIdle forgets clients whose buckets have refilled, as a new bucket
+// would be full anyway.
+func (l *rateLimiter) evictIdle(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for c, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, c)
+		}
+	}
+}
+
+// sweep evicts idle buckets every rateLimitSweepInterval.
+func (l *rateLimiter) sweep() {
+	for now := range time.Tick(rateLimitSweepInterval) {
+		l.evictIdle(now)
+	}
+}
+
+// rateLimit wraps next with limiter, or returns it unchanged when there
+// is no limit.
+func rateLimit(limiter *rateLimiter, next http.Handler) http.Handler {
+	if limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if ok, wait := limiter.allow(client, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
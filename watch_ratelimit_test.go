@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitSharedAcrossRoutes(t *testing.T) {
+	limiter := newRateLimiter(RateLimitConfig{RequestsPerMinute: 2})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	get, post := rateLimit(limiter, ok), rateLimit(limiter, ok)
+
+	var codes []int
+	for _, h := range []http.Handler{get, post, get} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/trees", nil))
+		codes = append(codes, w.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("status codes = %v, want [200 200 429]", codes)
+	}
+}
+
+func TestRateLimitEvictIdle(t *testing.T) {
+	limiter := newRateLimiter(RateLimitConfig{RequestsPerMinute: 60, Burst: 1})
+	now := time.Now()
+	limiter.allow("a", now)
+	limiter.allow("b", now.Add(60*time.Second+500*time.Millisecond))
+	limiter.evictIdle(now.Add(61 * time.Second))
+	if _, ok := limiter.buckets["a"]; ok {
+		t.Error("refilled bucket a was kept")
+	}
+	if _, ok := limiter.buckets["b"]; !ok {
+		t.Error("bucket b, still refilling, was evicted")
+	}
+}
+
+func TestRateLimitCoversEveryRoute(t *testing.T) {
+	limiter := newRateLimiter(RateLimitConfig{RequestsPerMinute: 60, Burst: 1})
+	h := apiHandler(ServerConfig{Pprof: true}, nil, limiter)
+	// Spend the burst.
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/search?q=cart", nil))
+
+	for _, route := range []struct{ method, target string }{
+		{http.MethodGet, "/search?q=cart"},
+		{http.MethodGet, "/state"},
+		{http.MethodPost, "/graphql"},
+		{http.MethodGet, "/debug/pprof/cmdline"},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(route.method, route.target, nil))
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("%s %s = %d, want 429", route.method, route.target, w.Code)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// eventReader collects watcher events into batches and hands each batch
+// on once no event has arrived for the settle time. Editors emit several
+// events per save; each path is recorded once per batch. main feeds it the
+// watcher's events on the real clock and --simulate a scenario on a fake
+// one.
+type eventReader struct {
+	settle time.Duration
+	repos  []string        // .git directories whose refs are watched
+	dirs   func() []string // The roots, which a reload may change
+	tasks  *taskRunner
+	push   func(changeBatch)
+
+	// note is told what became of each event, e.g. "ignored by *.swp".
+	note func(event fsnotify.Event, what string)
+	// accepted is called for each event inside a root that isn't
+	// ignored. Optional.
+	accepted func(event fsnotify.Event, root string, structural bool)
+
+	mu      sync.Mutex
+	timer   clockTimer
+	batch   changeBatch
+	renames renameTracker
+}
+
+func newEventReader(settle time.Duration, repos []string, dirs func() []string, tasks *taskRunner, push func(changeBatch)) *eventReader {
+	r := &eventReader{
+		settle: settle,
+		repos:  repos,
+		dirs:   dirs,
+		tasks:  tasks,
+		push:   push,
+		note:   func(fsnotify.Event, string) {},
+		batch:  newChangeBatch(),
+	}
+	r.timer = clk.AfterFunc(settle, r.settled)
+	r.timer.Stop()
+	return r
+}
+
+// handle adds an event to the current batch. Any activity pushes the batch
+// back until things are quiet.
+func (r *eventReader) handle(event fsnotify.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if gitDir := gitRefChange(r.repos, event.Name); gitDir != "" {
+		r.note(event, "refs moved in "+gitDir)
+		r.batch.movedRepos[gitDir] = true
+		r.timer.Reset(r.settle)
+		return
+	}
+	// Parents of watched files are watched too, and native recursive
+	// watches report changes inside ignored directories; skip both.
+	root := rootFor(r.dirs(), event.Name)
+	if isIgnoreFile(event.Name) {
+		invalidateIgnoreFiles()
+	}
+	if root == "" {
+		r.note(event, "outside every root")
+		return
+	}
+	if rule := matchIgnoreRule(event.Name); rule != "" {
+		r.note(event, "ignored by "+rule)
+		return
+	}
+	structural := isStructural(event, root)
+	if structural {
+		r.note(event, "structural")
+	} else {
+		r.note(event, "contents only")
+	}
+	r.tasks.notify(root, event.Name)
+	r.renames.observe(event)
+	r.batch.changed[event.Name] = r.batch.changed[event.Name] || structural
+	if r.accepted != nil {
+		r.accepted(event, root, structural)
+	}
+	r.timer.Reset(r.settle)
+}
+
+// settled hands on the batch when the settle timer fires.
+func (r *eventReader) settled() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.take()
+}
+
+// flush hands on the batch without waiting for things to settle, as
+// shutting down asks.
+func (r *eventReader) flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timer.Stop()
+	r.take()
+}
+
+// take pushes the current batch, if anything is in it, and starts the next.
+// The caller holds r.mu.
+func (r *eventReader) take() {
+	r.batch.renames = r.renames.take()
+	if !r.batch.empty() {
+		r.push(r.batch)
+	}
+	r.batch = newChangeBatch()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// useFakeClock runs the test on a fake clock starting at simulationStart.
+func useFakeClock(t *testing.T) *fakeClock {
+	t.Helper()
+	fake := newFakeClock(simulationStart)
+	previous := clk
+	clk = fake
+	t.Cleanup(func() { clk = previous })
+	return fake
+}
+
+func TestEventReaderSettles(t *testing.T) {
+	fake := useFakeClock(t)
+	configureIgnores(Config{})
+	var batches []changeBatch
+	dirs := func() []string { return []string{"src"} }
+	r := newEventReader(300*time.Millisecond, nil, dirs, newTaskRunner(nil), func(b changeBatch) {
+		batches = append(batches, b)
+	})
+
+	r.handle(fsnotify.Event{Name: "src/a.ts", Op: fsnotify.Create})
+	fake.advanceTo(simulationStart.Add(200 * time.Millisecond))
+	r.handle(fsnotify.Event{Name: "src/a.ts", Op: fsnotify.Write})
+	r.handle(fsnotify.Event{Name: "src/a.ts.swp", Op: fsnotify.Create})
+	r.handle(fsnotify.Event{Name: "other/b.ts", Op: fsnotify.Create})
+
+	fake.advanceTo(simulationStart.Add(499 * time.Millisecond))
+	if len(batches) != 0 {
+		t.Fatalf("batch handed on %v after the last event, before settling", fake.Now().Sub(simulationStart))
+	}
+	fake.advanceTo(simulationStart.Add(500 * time.Millisecond))
+	if len(batches) != 1 {
+		t.Fatalf("got %d batches once settled, want 1", len(batches))
+	}
+	if b := batches[0]; len(b.changed) != 1 || !b.changed["src/a.ts"] || !b.structural() {
+		t.Errorf("batch = %+v, want only src/a.ts, structural", b.changed)
+	}
+
+	// A contents-only change settles into a batch that doesn't regenerate.
+	r.handle(fsnotify.Event{Name: "src/a.ts", Op: fsnotify.Write})
+	r.flush()
+	if len(batches) != 2 || batches[1].structural() {
+		t.Errorf("flushed batches = %+v, want a second, contents-only batch", batches)
+	}
+	fake.advanceTo(simulationStart.Add(2 * time.Second))
+	if len(batches) != 2 {
+		t.Errorf("flushing left the settle timer running")
+	}
+}
+
+func TestTaskDebounce(t *testing.T) {
+	fake := useFakeClock(t)
+	var runs []time.Duration
+	tasks := newTaskRunner([]OnChangeRule{{Pattern: "*.ts", Command: []string{"true"}, Debounce: Duration{time.Second}}})
+	tasks.onRun = func(OnChangeRule) { runs = append(runs, fake.Now().Sub(simulationStart)) }
+
+	tasks.notify("src", "src/a.ts")
+	fake.advanceTo(simulationStart.Add(800 * time.Millisecond))
+	tasks.notify("src", "src/b.ts")
+	tasks.notify("src", "src/c.go")
+	fake.advanceTo(simulationStart.Add(5 * time.Second))
+	if len(runs) != 1 || runs[0] != 1800*time.Millisecond {
+		t.Errorf("task ran at %v, want once at 1.8s", runs)
+	}
+}
+
+func TestIntervalGate(t *testing.T) {
+	fake := useFakeClock(t)
+	var ticks []time.Duration
+	gate := newIntervalGate(time.Minute, func() { ticks = append(ticks, fake.Now().Sub(simulationStart)) })
+
+	fake.advanceTo(simulationStart.Add(90 * time.Second))
+	gate.mark()
+	gate.mark()
+	fake.advanceTo(simulationStart.Add(5 * time.Minute))
+	if len(ticks) != 1 || ticks[0] != 2*time.Minute {
+		t.Errorf("regenerated at %v, want once at the 2m tick", ticks)
+	}
+}
+
+func TestScheduleOnFakeClock(t *testing.T) {
+	fake := useFakeClock(t)
+	s, err := parseSchedule("0 9 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fired []time.Time
+	startSchedule(s, func() { fired = append(fired, fake.Now()) })
+
+	// simulationStart is a Monday at midnight.
+	fake.advanceTo(simulationStart.Add(7 * 24 * time.Hour))
+	if len(fired) != 5 {
+		t.Fatalf("fired %d times in a week, want 5: %v", len(fired), fired)
+	}
+	for _, at := range fired {
+		if at.Hour() != 9 || at.Minute() != 0 || at.Weekday() == time.Saturday || at.Weekday() == time.Sunday {
+			t.Errorf("fired at %v, want weekdays at 09:00", at)
+		}
+	}
+}
+
+func TestRenamePairsOnFakeClock(t *testing.T) {
+	fake := useFakeClock(t)
+	useFixture(t, fstest.MapFS{"src/new.ts": {}, "src/later.ts": {}})
+	configureIgnores(Config{})
+	var batches []changeBatch
+	r := newEventReader(300*time.Millisecond, nil, func() []string { return []string{"src"} }, newTaskRunner(nil), func(b changeBatch) {
+		batches = append(batches, b)
+	})
+
+	r.handle(fsnotify.Event{Name: "src/old.ts", Op: fsnotify.Rename})
+	fake.advanceTo(simulationStart.Add(50 * time.Millisecond))
+	r.handle(fsnotify.Event{Name: "src/new.ts", Op: fsnotify.Create})
+	// Too long after the Rename to be its other half.
+	r.handle(fsnotify.Event{Name: "src/gone.ts", Op: fsnotify.Rename})
+	fake.advanceTo(simulationStart.Add(200 * time.Millisecond))
+	r.handle(fsnotify.Event{Name: "src/later.ts", Op: fsnotify.Create})
+	r.flush()
+
+	if len(batches) != 1 {
+		t.Fatalf("got %d batches, want 1", len(batches))
+	}
+	want := []renamePair{{from: "src/old.ts", to: "src/new.ts"}}
+	if got := batches[0].renames; !slices.Equal(got, want) {
+		t.Errorf("renames = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// fileRecord is one line of the "jsonl" output: a flat description of a
+// file or directory, so jq and duckdb can aggregate without recursing.
+//
+//	{"root":"src","path":"src/app/page.tsx","type":"file","size":2048,"mtime":"…"}
+type fileRecord struct {
+	Root    string    `json:"root"`
+	Path    string    `json:"path"` // As in the JSON output
+	Type    string    `json:"type"` // "file" or "directory"
+	Size    int64     `json:"size"` // For directories the total of their files
+	ModTime time.Time `json:"mtime"`
+}
+
+// fileRecords flattens the roots in path order, roots before their
+// contents.
+func fileRecords(roots []generatedRoot) []fileRecord {
+	var records []fileRecord
+	for _, root := range newTreeDocument(roots).Roots {
+		var walk func(node *watchapi.Node)
+		walk = func(node *watchapi.Node) {
+			records = append(records, fileRecord{
+				Root:    root.Directory,
+				Path:    node.Path,
+				Type:    node.Kind,
+				Size:    node.Size,
+				ModTime: node.ModTime,
+			})
+			for _, child := range node.Children {
+				walk(child)
+			}
+		}
+		walk(root.Tree)
+	}
+	return records
+}
+
+// displayRecords applies the Paths mode and the redactor to the records'
+// paths.
+func displayRecords(roots []generatedRoot, opts RenderConfig) []fileRecord {
+	records := fileRecords(roots)
+	for i, record := range records {
+		if display, ok := opts.displayPath(record.Root, filepath.FromSlash(record.Path)); ok {
+			records[i].Path = display
+		}
+		records[i].Root = redactText(record.Root)
+		records[i].Path = redactText(records[i].Path)
+	}
+	return records
+}
+
+func renderJSONL(roots []generatedRoot, opts RenderConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range displayRecords(roots, opts) {
+		if err := enc.Encode(record); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// parseJSONLSnapshot reads the "jsonl" output, in any Paths mode. Root
+// records are skipped unless the root is a file, matching the other
+// formats.
+func parseJSONLSnapshot(data []byte) (snapshotEntries, error) {
+	entries := make(snapshotEntries)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record fileRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, err
+		}
+		record.Path = rootedRecordPath(record.Root, record.Path)
+		isDir := record.Type == "directory"
+		if record.Path == record.Root && isDir {
+			continue
+		}
+		entries[record.Path] = snapshotEntry{IsDir: isDir, Size: record.Size, ModTime: record.ModTime}
+	}
+	return entries, scanner.Err()
+}
+
+// rootedRecordPath turns a record path written in the relative or absolute
+// Paths mode back into one starting with its root.
+func rootedRecordPath(root, p string) string {
+	if filepath.IsAbs(filepath.FromSlash(p)) {
+		if abs, err := filepath.Abs(root); err == nil {
+			if rel, err := filepath.Rel(abs, filepath.FromSlash(p)); err == nil {
+				p = filepath.ToSlash(rel)
+			}
+		}
+	} else if p == root || strings.HasPrefix(p, rootPrefix(root)+"/") {
+		return p
+	}
+	if p == "." {
+		return root
+	}
+	return joinSnapshotPath(rootPrefix(root), p)
+}
+
+// isJSONL reports whether data holds one JSON object per line rather than
+// a single indented document.
+func isJSONL(data []byte) bool {
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	var record struct {
+		Path *string `json:"path"`
+	}
+	return json.Unmarshal(first, &record) == nil && record.Path != nil
+}
+
+// renderCSV lists every file with its extension, size, modification time
+// and line count, for auditing in a spreadsheet. The "tsv" format uses
+// tabs instead of commas.
+func renderCSV(roots []generatedRoot, opts RenderConfig, comma rune) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = comma
+	w.Write([]string{"path", "extension", "size", "mtime", "lines"})
+	records := fileRecords(roots)
+	for i, record := range displayRecords(roots, opts) {
+		if record.Type != "file" {
+			continue
+		}
+		lines := 0
+		path := filepath.FromSlash(records[i].Path)
+		if info, err := fsys.Stat(path); err == nil && !isRemoteRoot(record.Root) {
+			lines = countLines(path, info.Size())
+		}
+		w.Write([]string{
+			record.Path,
+			strings.ToLower(strings.TrimPrefix(filepath.Ext(record.Path), ".")),
+			strconv.FormatInt(record.Size, 10),
+			formatTime(record.ModTime),
+			strconv.Itoa(lines),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// crashFileName collects a diagnostic dump for every recovered panic.
+const crashFileName = ".watch-crash.log"
+
+// recovered runs fn, turning a panic into a log line and a dump in
+// crashFileName so the daemon stays up rather than dying silently.
+// describe, if not nil, says what fn was working on.
+func recovered(name string, describe func() string, fn func()) (panicked bool) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		panicked = true
+		stack := debug.Stack()
+		log.Printf("Recovered from panic in %s: %v (details in %s)\n", name, r, crashFileName)
+		var working string
+		if describe != nil {
+			working = describe()
+		}
+		if err := dumpCrash(name, r, stack, working); err != nil {
+			log.Printf("Error writing %s: %v\n", crashFileName, err)
+		}
+	}()
+	fn()
+	return false
+}
+
+// supervise runs fn on its own goroutine, starting it again a second
+// after each panic, until it returns normally.
+func supervise(name string, fn func()) {
+	go func() {
+		for recovered(name, nil, fn) {
+			time.Sleep(time.Second)
+			log.Printf("Restarting %s\n", name)
+		}
+	}()
+}
+
+func dumpCrash(name string, r any, stack []byte, working string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "=== Panic in %s at %s\n", name, time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "panic: %v\n\n%s\n", r, stack)
+	if working != "" {
+		fmt.Fprintf(&b, "Working on: %s\n", working)
+	}
+
+	stateMu.Lock()
+	data, _ := json.Marshal(state)
+	stateMu.Unlock()
+	fmt.Fprintf(&b, "State: %s\n", data)
+
+	treeCacheMu.Lock()
+	dirs := make([]string, 0, len(builtRoots))
+	counts := make(map[string]int)
+	for dir, root := range builtRoots {
+		dirs = append(dirs, dir)
+		counts[dir] = countNodes(root.Tree) - 1
+	}
+	treeCacheMu.Unlock()
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		fmt.Fprintf(&b, "Tree: %s (%s entries)\n", dir, groupThousands(counts[dir]))
+	}
+	b.WriteString("\n")
+
+	file, err := os.OpenFile(crashFileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(b.String())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// describe summarizes a batch for a crash dump.
+func (b changeBatch) describe() string {
+	paths := make([]string, 0, len(b.changed))
+	for path := range b.changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	const shown = 20
+	more := ""
+	if len(paths) > shown {
+		more = fmt.Sprintf(" and %d more", len(paths)-shown)
+		paths = paths[:shown]
+	}
+	return fmt.Sprintf("%d changed paths: %s%s", len(b.changed), strings.Join(paths, ", "), more)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// redactor rewrites the paths and names shown in output when --redact is
+// given: the home directory becomes "~" and each configured segment its
+// placeholder. A reload replaces it under settingsMu.
+var redactor *strings.Replacer
+
+// enableRedaction builds the redactor from the configured segments.
+func enableRedaction(segments map[string]string) {
+	pairs := make(map[string]string, len(segments)+2)
+	for segment, placeholder := range segments {
+		if placeholder == "" {
+			placeholder = "[redacted]"
+		}
+		pairs[segment] = placeholder
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		pairs[home] = "~"
+		pairs[filepath.ToSlash(home)] = "~"
+	}
+
+	// Longest first, so a segment containing another wins.
+	olds := make([]string, 0, len(pairs))
+	for old := range pairs {
+		if old != "" {
+			olds = append(olds, old)
+		}
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+		return olds[i] < olds[j]
+	})
+	var args []string
+	for _, old := range olds {
+		args = append(args, old, pairs[old])
+	}
+	settingsMu.Lock()
+	redactor = strings.NewReplacer(args...)
+	settingsMu.Unlock()
+}
+
+// redactText applies the redactor, if enabled, to a path or name about to
+// be rendered. Rendered output itself is never rewritten: encodings escape
+// paths, e.g. a Windows home directory in JSON, so it wouldn't match.
+func redactText(s string) string {
+	settingsMu.RLock()
+	r := redactor
+	settingsMu.RUnlock()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// redactDocument applies the redactor to the paths and names in doc.
+func redactDocument(doc *watchapi.Document) {
+	for i := range doc.Roots {
+		root := &doc.Roots[i]
+		root.Directory = redactText(root.Directory)
+		root.Alias = redactText(root.Alias)
+		root.Group = redactText(root.Group)
+		root.Union = redactAll(root.Union)
+		redactNode(root.Tree)
+	}
+}
+
+func redactNode(node *watchapi.Node) {
+	node.Name = redactText(node.Name)
+	node.Path = redactText(node.Path)
+	node.Note = redactText(node.Note)
+	node.Origins = redactAll(node.Origins)
+	for _, child := range node.Children {
+		redactNode(child)
+	}
+}
+
+// redactAll returns a redacted copy of list; the original may be shared
+// with the config or the tree.
+func redactAll(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	redacted := make([]string, len(list))
+	for i, s := range list {
+		redacted[i] = redactText(s)
+	}
+	return redacted
+}
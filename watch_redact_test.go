@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// useRedaction enables --redact with segments for the test.
+func useRedaction(t *testing.T, segments map[string]string) {
+	t.Helper()
+	enableRedaction(segments)
+	t.Cleanup(func() {
+		settingsMu.Lock()
+		redactor = nil
+		settingsMu.Unlock()
+	})
+}
+
+func TestRedactionSurvivesEncoding(t *testing.T) {
+	// The repository's own config watches a Windows home directory, which
+	// JSON escapes to C:\\Users\\Jrami.
+	useRedaction(t, map[string]string{`C:\Users\Jrami`: "~", "acme": ""})
+	dir := `C:\Users\Jrami\shop`
+	tree := &treeNode{Name: dir, IsDir: true, Children: []*treeNode{
+		{Name: "acme-invoice.ts", Size: 10, Note: "for acme", Origins: []string{dir}},
+	}}
+	union := []string{dir}
+	roots := []generatedRoot{{Dir: dir, Tree: tree}, {Dir: "merged", Tree: tree, Union: union}}
+
+	for _, format := range []string{"text", "json", "jsonl", "csv", "bundle"} {
+		data, err := render(format, roots, RenderConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"Jrami", "acme"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s output contains %q:\n%s", format, secret, data)
+			}
+		}
+	}
+
+	doc := newTreeDocument(roots)
+	redactDocument(&doc)
+	if got := doc.Roots[0].Tree.Children[0].Path; got != `~\shop/[redacted]-invoice.ts` {
+		t.Errorf("redacted path = %q", got)
+	}
+	if union[0] != dir || tree.Children[0].Origins[0] != dir {
+		t.Errorf("redacting changed the roots: union %v, origins %v", union, tree.Children[0].Origins)
+	}
+}
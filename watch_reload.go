@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+// liveConfig is the configuration in effect, replaced on SIGHUP.
+type liveConfig struct {
+	mu     sync.RWMutex
+	config Config
+}
+
+func (l *liveConfig) get() Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.config
+}
+
+func (l *liveConfig) set(config Config) {
+	l.mu.Lock()
+	l.config = config
+	l.mu.Unlock()
+}
+
+// settingsMu guards the settings taken from the config that a reload
+// replaces: displayFormat, memoryLimit, ignoreList, generatedMode,
+// mimeRules, entryNotes, readmeNotes and tagRules. They are swapped whole
+// under the write lock and never modified in place, so readers only hold
+// the read lock while copying them out.
+var settingsMu sync.RWMutex
+
+// builtinIgnores is ignoreList before the config added to it.
+var builtinIgnores = slices.Clone(ignoreList)
+
+// reloadOnHangup rereads the config file and regenerates the trees on
+// every SIGHUP, as daemons conventionally do. Outputs, rendering, ignore
+// rules and new local roots take effect; the API, database, index,
+// onChange rules and remote polling keep their startup settings until a
+// restart. A config that fails to load or whose outputs aren't writable
+// is reported and the previous one kept.
+func reloadOnHangup(live *liveConfig, watcher *treeWatcher, redacting bool, regenerate func()) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			log.Printf("SIGHUP received: reloading %s\n", configFileName)
+			if reloadConfig(live, watcher, redacting) {
+				log.Println("Regenerating all trees...")
+			} else {
+				log.Println("Keeping the previous configuration; regenerating all trees...")
+			}
+			regenerate()
+		}
+	}()
+}
+
+func reloadConfig(live *liveConfig, watcher *treeWatcher, redacting bool) bool {
+	config, err := readConfig()
+	if err != nil {
+		log.Printf("Error loading %s: %v\n", configFileName, err)
+		return false
+	}
+	if errs := config.validate(); len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("Error: %v\n", err)
+		}
+		return false
+	}
+
+	previous := live.get()
+	setDisplay(config)
+	setNotes(config.Notes, config.ReadmeNotes)
+	setTags(config.Tags)
+	configureIgnores(config)
+	invalidateIgnoreFiles()
+	if redacting {
+		enableRedaction(config.Redact)
+	}
+	for _, dir := range config.Directories {
+		if slices.Contains(previous.Directories, dir) {
+			continue
+		}
+		if isRemoteRoot(dir) {
+			log.Printf("Remote root %s is polled after a restart\n", dir)
+			continue
+		}
+		log.Printf("Adding watcher for directory: %s\n", dir)
+		if err := watcher.AddRoot(dir); err != nil {
+			log.Printf("Error walking directory tree for %s: %v\n", dir, err)
+		}
+	}
+	live.set(config)
+	return true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Run with -race: reloading settings while trees are built must not race.
+func TestSettingsReloadWhileBuilding(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.ts", "b.png", "lib/c.ts"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		setDisplay(Config{})
+		setNotes(nil, false)
+		setTags(nil)
+		configureIgnores(Config{})
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			config := Config{
+				Display:   FormatConfig{Size: "si"},
+				Generated: "mark",
+				MimeTypes: []MimeRule{{Type: "image/*", Action: "summarize"}},
+				Notes:     map[string]string{"lib": "library"},
+				Tags:      map[string]string{"*.ts": "ts"},
+			}
+			setDisplay(config)
+			setNotes(config.Notes, config.ReadmeNotes)
+			setTags(config.Tags)
+			configureIgnores(config)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			tree, err := buildLocalTree(context.Background(), dir)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			annotateNotes(dir, tree)
+			annotateTags(dir, tree)
+			formatSize(tree.Size)
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultRemotePollInterval = 30 * time.Second
+
+// remoteSnapshot is the latest listing fetched for a remote root.
+type remoteSnapshot struct {
+	tree *treeNode
+	hash [sha256.Size]byte
+}
+
+var (
+	remoteMu        sync.Mutex
+	remoteSnapshots = make(map[string]*remoteSnapshot)
+)
+
+// isRemoteRoot reports whether a configured directory is a remote URL
+// rather than a local path.
+func isRemoteRoot(dir string) bool {
+	return strings.HasPrefix(dir, "ssh://") || strings.HasPrefix(dir, "docker://")
+}
+
+// remoteTree returns the most recently fetched tree for a remote root.
+func remoteTree(rootDir string) (*treeNode, error) {
+	remoteMu.Lock()
+	defer remoteMu.Unlock()
+	snap := remoteSnapshots[rootDir]
+	if snap == nil {
+		return nil, fmt.Errorf("no listing fetched yet for %s", rootDir)
+	}
+	return snap.tree, nil
+}
+
+// startRemotePolling fetches every remote root once, then re-fetches them
+// every interval in the background, calling onChange whenever a listing
+// differs from the previous one.
+func startRemotePolling(directories []string, interval time.Duration, onChange func()) {
+	var remotes []string
+	for _, dir := range directories {
+		if isRemoteRoot(dir) {
+			remotes = append(remotes, dir)
+		}
+	}
+	if len(remotes) == 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = defaultRemotePollInterval
+	}
+
+	for _, dir := range remotes {
+		log.Printf("Fetching remote directory: %s\n", dir)
+		if _, err := refreshRemote(dir); err != nil {
+			log.Printf("Error listing %s: %v\n", dir, err)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			changed := false
+			for _, dir := range remotes {
+				c, err := refreshRemote(dir)
+				if err != nil {
+					log.Printf("Error listing %s: %v\n", dir, err)
+					continue
+				}
+				if c {
+					log.Printf("Change detected: %s. Regenerating all trees...\n", dir)
+					changed = true
+				}
+			}
+			if changed {
+				onChange()
+			}
+		}
+	}()
+}
+
+// refreshRemote fetches a new listing for dir and reports whether it
+// differs from the previous one.
+func refreshRemote(dir string) (bool, error) {
+	listing, err := fetchRemoteListing(dir)
+	if err != nil {
+		return false, err
+	}
+	tree, err := parseRemoteListing(dir, listing)
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.Sum256(listing)
+
+	remoteMu.Lock()
+	defer remoteMu.Unlock()
+	prev := remoteSnapshots[dir]
+	remoteSnapshots[dir] = &remoteSnapshot{tree: tree, hash: hash}
+	return prev == nil || prev.hash != hash, nil
+}
+
+// fetchRemoteListing lists a remote root using the transport its URL
+// scheme selects.
+func fetchRemoteListing(dir string) ([]byte, error) {
+	if strings.HasPrefix(dir, "docker://") {
+		return fetchDockerListing(dir)
+	}
+	return fetchSSHListing(dir)
+}
+
+// fetchSSHListing runs the listing command on the remote host through the
+// system ssh client, so the user's keys, agent and ~/.ssh/config apply as
+// usual.
+func fetchSSHListing(dir string) ([]byte, error) {
+	u, err := url.Parse(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	target := u.Hostname()
+	if u.User != nil {
+		target = u.User.Username() + "@" + target
+	}
+	args := []string{"-o", "BatchMode=yes"}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, target, remoteListCommand(sshPath(u)))
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("ssh", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func sshPath(u *url.URL) string {
+	path := u.Path
+	if path == "/~" || strings.HasPrefix(path, "/~/") {
+		// ssh://host/~/project means relative to the home directory,
+		// which is where ssh runs the command; a quoted "~" wouldn't
+		// expand.
+		path = strings.TrimPrefix(strings.TrimPrefix(path, "/~"), "/")
+	}
+	if path == "" {
+		path = "."
+	}
+	return path
+}
+
+// remoteListPath returns the directory a remote root URL points at.
+func remoteListPath(dir string) string {
+	if strings.HasPrefix(dir, "docker://") {
+		_, path := parseDockerRoot(dir)
+		return path
+	}
+	u, err := url.Parse(dir)
+	if err != nil {
+		return ""
+	}
+	return sshPath(u)
+}
+
+// remoteListCommand builds a shell command printing one
+// "type\tsize\tmtime\tpath" line per entry under path. Ignored names are
+// pruned remotely to keep the transfer small. GNU find's -printf is used
+// when available, falling back to stat for busybox-based hosts.
+func remoteListCommand(path string) string {
+	var prune []string
+	for _, item := range ignoreRules() {
+		prune = append(prune, "-name "+shellQuote(item))
+	}
+	find := fmt.Sprintf("find %s -mindepth 1 \\( %s \\) -prune -o", shellQuote(path), strings.Join(prune, " -o "))
+	return fmt.Sprintf("if find . -maxdepth 0 -printf '' >/dev/null 2>&1; "+
+		"then %s -printf '%%y\\t%%s\\t%%T@\\t%%P\\n'; "+
+		"else %s -exec stat -c '%%F\t%%s\t%%Y\t%%n' {} +; fi",
+		find, find)
+}
+
+// parseRemoteListing turns lines of "type\tsize\tmtime\tpath" into a tree.
+// Paths are relative (find -printf) or prefixed with the listed directory
+// (stat fallback).
+func parseRemoteListing(rootDir string, listing []byte) (*treeNode, error) {
+	root := &treeNode{Name: rootDir, IsDir: true}
+	prefix := strings.TrimSuffix(remoteListPath(rootDir), "/") + "/"
+	scanner := bufio.NewScanner(bytes.NewReader(listing))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		relPath := strings.TrimPrefix(fields[3], prefix)
+		if relPath == "" {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		secs, _ := strconv.ParseFloat(fields[2], 64)
+		node := &treeNode{
+			IsDir:   fields[0] == "d" || fields[0] == "directory",
+			Size:    size,
+			ModTime: time.Unix(int64(secs), 0),
+		}
+		insertPath(root, relPath, node)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sortTree(root)
+	return root, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
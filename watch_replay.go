@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// recordedEvent is one line of a --record file: a raw event as the
+// watcher delivered it.
+type recordedEvent struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"` // As fsnotify prints it, e.g. "CREATE|CHMOD"
+	Name string    `json:"name"`
+}
+
+var eventOps = map[string]fsnotify.Op{
+	"CREATE": fsnotify.Create,
+	"WRITE":  fsnotify.Write,
+	"REMOVE": fsnotify.Remove,
+	"RENAME": fsnotify.Rename,
+	"CHMOD":  fsnotify.Chmod,
+}
+
+func parseOp(s string) (fsnotify.Op, error) {
+	var op fsnotify.Op
+	for _, name := range strings.Split(s, "|") {
+		bit, ok := eventOps[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown event op %q", name)
+		}
+		op |= bit
+	}
+	return op, nil
+}
+
+// recordEvents appends every event passing through to file, for
+// --replay to feed back later.
+func recordEvents(file string, events <-chan fsnotify.Event) (<-chan fsnotify.Event, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan fsnotify.Event, cap(events))
+	go func() {
+		defer f.Close()
+		defer close(out)
+		enc := json.NewEncoder(f)
+		for event := range events {
+			if err := enc.Encode(recordedEvent{Time: time.Now().UTC(), Op: event.Op.String(), Name: event.Name}); err != nil {
+				log.Printf("Error recording event to %s: %v\n", file, err)
+			}
+			out <- event
+		}
+	}()
+	return out, nil
+}
+
+// readRecording parses a --record file.
+func readRecording(file string) ([]recordedEvent, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var recorded []recordedEvent
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e recordedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, line, err)
+		}
+		if _, err := parseOp(e.Op); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, line, err)
+		}
+		recorded = append(recorded, e)
+	}
+	return recorded, scanner.Err()
+}
+
+// event returns the event as the watcher delivered it.
+func (e recordedEvent) event() fsnotify.Event {
+	op, _ := parseOp(e.Op)
+	return fsnotify.Event{Name: e.Name, Op: op}
+}
+
+// replayEvents reads a --record file and delivers its events with the
+// gaps they were recorded with, so race and debounce bugs reproduce
+// without touching the filesystem. finished is closed after the last
+// one.
+func replayEvents(file string) (events <-chan fsnotify.Event, finished <-chan struct{}, err error) {
+	recorded, err := readRecording(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := make(chan fsnotify.Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		start := clk.Now()
+		for _, e := range recorded {
+			// Waiting for each event's offset from the start, rather than
+			// its gap from the previous one, keeps slow consumers from
+			// stretching the recording.
+			if wait := start.Add(e.Time.Sub(recorded[0].Time)).Sub(clk.Now()); wait > 0 {
+				<-clk.NewTimer(wait).C()
+			}
+			out <- e.event()
+		}
+		log.Printf("Replayed %s from %s\n", plural(len(recorded), "event"), file)
+	}()
+	return out, done, nil
+}
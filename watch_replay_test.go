@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// replayOnFakeClock runs replayEvents on the fake clock, advancing it to
+// each wait replayEvents blocks on, hands every event to r, then lets
+// everything settle.
+func replayOnFakeClock(t *testing.T, fake *fakeClock, r *eventReader, file string) {
+	t.Helper()
+	events, finished, err := replayEvents(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case e := <-events:
+			r.handle(e)
+			continue
+		case <-finished:
+			fake.advanceTo(fake.Now().Add(time.Minute))
+			return
+		default:
+		}
+		if when, ok := replayWait(fake); ok {
+			fake.advanceTo(when)
+		} else {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// replayWait reports when the timer replayEvents is blocked on is due.
+// It's the only channel timer; the reader's are all AfterFunc.
+func replayWait(fake *fakeClock) (time.Time, bool) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for _, timer := range fake.timers {
+		if timer.f == nil {
+			return timer.when, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func TestReplayVimSave(t *testing.T) {
+	fake := useFakeClock(t)
+	configureIgnores(Config{})
+	type settledBatch struct {
+		at    time.Duration
+		batch changeBatch
+	}
+	var batches []settledBatch
+	dirs := func() []string { return []string{"src"} }
+	r := newEventReader(300*time.Millisecond, nil, dirs, newTaskRunner(nil), func(b changeBatch) {
+		batches = append(batches, settledBatch{fake.Now().Sub(simulationStart), b})
+	})
+
+	replayOnFakeClock(t, fake, r, "testdata/replay/vim-save.jsonl")
+
+	if len(batches) != 2 {
+		t.Fatalf("got %d batches, want 2: %+v", len(batches), batches)
+	}
+	// vim's probe file, backup and swap file are ignored; the save itself
+	// regenerates once, 300ms after the last event for page.tsx.
+	if b := batches[0]; b.at != 311*time.Millisecond || len(b.batch.changed) != 1 || !b.batch.changed["src/app/page.tsx"] || !b.batch.structural() {
+		t.Errorf("first batch at %v = %+v, want only src/app/page.tsx, structural, at 311ms", b.at, b.batch.changed)
+	}
+	// Writes in place only touch contents, and node_modules is outside the
+	// root.
+	if b := batches[1]; b.at != 2400*time.Millisecond || len(b.batch.changed) != 1 || b.batch.structural() {
+		t.Errorf("second batch at %v = %+v, want only src/lib/cart.ts, contents only, at 2.4s", b.at, b.batch.changed)
+	}
+}
+
+func TestReadRecordingRejectsUnknownOps(t *testing.T) {
+	file := t.TempDir() + "/events.jsonl"
+	line := `{"time":"2024-03-05T10:00:00Z","op":"CREATE|OPEN","name":"src/a.ts"}` + "\n"
+	if err := os.WriteFile(file, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRecording(file); err == nil {
+		t.Error("readRecording accepted an unknown op")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/gob"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// treeCacheFileName holds the trees and summaries of the last generation,
+// written on shutdown for --resume.
+const treeCacheFileName = ".watch-trees.cache"
+
+// treeCacheVersion changes whenever treeNode does, so caches written by
+// older builds are discarded rather than misread.
+const treeCacheVersion = 1
+
+type treeCache struct {
+	Version int
+	Roots   map[string]*cachedRoot
+}
+
+type cachedRoot struct {
+	Tree    *treeNode
+	Summary string
+}
+
+var (
+	treeCacheMu sync.Mutex
+	// Local roots as last generated, saved on shutdown.
+	builtRoots = make(map[string]*cachedRoot)
+	// Roots loaded by --resume, each used once instead of a walk.
+	resumedRoots = make(map[string]*cachedRoot)
+)
+
+// rememberTree records the tree built for a local root.
+func rememberTree(dir string, tree *treeNode) {
+	// The generation goes on to annotate, strip workspaces from and
+	// prune its tree; the cache keeps it as built.
+	tree = cloneTree(tree)
+	treeCacheMu.Lock()
+	defer treeCacheMu.Unlock()
+	if builtRoots[dir] == nil {
+		builtRoots[dir] = &cachedRoot{}
+	}
+	builtRoots[dir].Tree = tree
+}
+
+// rememberSummary records the summary generated for a local root.
+func rememberSummary(dir string, summary string) {
+	treeCacheMu.Lock()
+	defer treeCacheMu.Unlock()
+	if root := builtRoots[dir]; root != nil {
+		root.Summary = summary
+	}
+}
+
+// takeResumedTree returns the tree loaded for dir by --resume, once.
+func takeResumedTree(dir string) *treeNode {
+	treeCacheMu.Lock()
+	defer treeCacheMu.Unlock()
+	root := resumedRoots[dir]
+	if root == nil {
+		return nil
+	}
+	tree := root.Tree
+	root.Tree = nil
+	return tree
+}
+
+// takeResumedSummary returns the summary loaded for dir by --resume,
+// once.
+func takeResumedSummary(dir string) (string, bool) {
+	treeCacheMu.Lock()
+	defer treeCacheMu.Unlock()
+	root := resumedRoots[dir]
+	delete(resumedRoots, dir)
+	if root == nil || root.Summary == "" {
+		return "", false
+	}
+	return root.Summary, true
+}
+
+// saveTreeCache writes the trees of the last generation for --resume.
+func saveTreeCache() {
+	treeCacheMu.Lock()
+	cache := treeCache{Version: treeCacheVersion, Roots: builtRoots}
+	defer treeCacheMu.Unlock()
+	if len(cache.Roots) == 0 {
+		return
+	}
+
+	tmp := treeCacheFileName + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		log.Printf("Error writing %s: %v\n", treeCacheFileName, err)
+		return
+	}
+	err = gob.NewEncoder(file).Encode(cache)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, treeCacheFileName)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Printf("Error writing %s: %v\n", treeCacheFileName, err)
+	}
+}
+
+// loadTreeCache reads the roots saved on the last shutdown and keeps
+// those of the given roots that still look current, so the first
+// generation can skip walking them. Only the root and its top-level
+// entries are checked: a change deeper down that left their
+// modification times alone goes unnoticed until the next event there.
+func loadTreeCache(directories []string) {
+	file, err := os.Open(treeCacheFileName)
+	if os.IsNotExist(err) {
+		log.Printf("No %s yet; walking every root.\n", treeCacheFileName)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading %s: %v\n", treeCacheFileName, err)
+		return
+	}
+	defer file.Close()
+	var cache treeCache
+	if err := gob.NewDecoder(file).Decode(&cache); err != nil || cache.Version != treeCacheVersion {
+		log.Printf("Ignoring %s: written by another version\n", treeCacheFileName)
+		return
+	}
+
+	treeCacheMu.Lock()
+	defer treeCacheMu.Unlock()
+	for _, dir := range directories {
+		if isRemoteRoot(dir) {
+			continue
+		}
+		root := cache.Roots[dir]
+		if root == nil || root.Tree == nil {
+			continue
+		}
+		if stale := staleEntry(dir, root.Tree); stale != "" {
+			log.Printf("%s changed since the last run; walking %s\n", stale, dir)
+			continue
+		}
+		log.Printf("Resuming %s from %s\n", dir, treeCacheFileName)
+		resumedRoots[dir] = root
+	}
+}
+
+// staleEntry returns the first of a root and its top-level entries whose
+// modification time no longer matches the cached tree, or "".
+func staleEntry(dir string, tree *treeNode) string {
+	info, err := fsys.Stat(dir)
+	if err != nil || !info.ModTime().Equal(tree.ModTime) || info.IsDir() != tree.IsDir {
+		return dir
+	}
+	for _, child := range tree.Children {
+		path := filepath.Join(dir, child.Name)
+		info, err := fsys.Lstat(path)
+		if err != nil || !info.ModTime().Equal(child.ModTime) {
+			return path
+		}
+	}
+	return ""
+}
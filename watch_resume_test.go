@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestRememberTreeKeepsBuiltTree(t *testing.T) {
+	tree := &treeNode{Name: "src", IsDir: true, Children: []*treeNode{
+		{Name: "app", IsDir: true, Children: []*treeNode{{Name: "page.tsx"}}},
+		{Name: "packages", IsDir: true, Children: []*treeNode{{Name: "ui", IsDir: true}}},
+	}}
+	rememberTree("src", tree)
+	t.Cleanup(func() { delete(builtRoots, "src") })
+
+	// What a generation does to its tree after remembering it.
+	tree.Children = tree.Children[:1]
+	tree.Children[0].Children = nil
+	tree.Children[0].Note = "routes"
+
+	cached := builtRoots["src"].Tree
+	if len(cached.Children) != 2 || len(cached.Children[0].Children) != 1 || cached.Children[0].Note != "" {
+		t.Errorf("cached tree changed with the generation's: %+v", cached.Children)
+	}
+}
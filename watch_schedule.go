@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression from the config file: five fields
+// (minute, hour, day of month, month, day of week) such as "*/15 * * * *",
+// one of @hourly, @daily, @weekly and @monthly, or "@every 10m".
+type Schedule struct {
+	spec   string
+	every  time.Duration
+	fields [5]uint64 // Bit i set when value i matches
+	// Whether the day of month and day of week were restricted; when both
+	// are, a day matching either one matches, as in cron.
+	domStar, dowStar bool
+}
+
+var scheduleMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Bounds of each cron field.
+var cronFields = [5]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 7 is Sunday too
+}
+
+func parseSchedule(spec string) (Schedule, error) {
+	s := Schedule{spec: spec}
+	expr := strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return Schedule{}, fmt.Errorf("schedule %q: %v", spec, err)
+		}
+		if every < time.Second {
+			return Schedule{}, fmt.Errorf("schedule %q: interval must be at least 1s", spec)
+		}
+		s.every = every
+		return s, nil
+	}
+	if macro, ok := scheduleMacros[expr]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return Schedule{}, fmt.Errorf("schedule %q: want 5 fields, got %d", spec, len(fields))
+	}
+	for i, field := range fields {
+		bits, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("schedule %q: %s: %v", spec, cronFields[i].name, err)
+		}
+		s.fields[i] = bits
+	}
+	if s.fields[4]&(1<<7) != 0 {
+		s.fields[4] |= 1
+	}
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	return s, nil
+}
+
+// parseCronField reads a comma-separated list of *, n, a-b, each
+// optionally followed by /step.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", from)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				hi = max
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("%q is outside %d-%d", rangePart, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (s Schedule) isZero() bool {
+	return s.spec == ""
+}
+
+func (s Schedule) String() string {
+	return s.spec
+}
+
+// next returns the first time after t the schedule fires, or the zero
+// time if it never does, such as for February 30th.
+func (s Schedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.fields[3]&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.fields[1]&(1<<t.Hour()) == 0:
+			// Truncate works in absolute time, which misses the hour in
+			// zones offset by a fraction of one.
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.fields[0]&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := s.fields[2]&(1<<t.Day()) != 0
+	dow := s.fields[4]&(1<<int(t.Weekday())) != 0
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dow
+	case s.dowStar:
+		return dom
+	}
+	return dom || dow
+}
+
+func (s Schedule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.spec)
+}
+
+func (s *Schedule) UnmarshalJSON(b []byte) error {
+	var spec string
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return err
+	}
+	parsed, err := parseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// startSchedule calls onTick every time the schedule fires, in the
+// background, for changes no watcher reports, such as on FUSE mounts or
+// volumes written by a database.
+func startSchedule(s Schedule, onTick func()) {
+	if s.isZero() {
+		return
+	}
+	var arm func()
+	arm = func() {
+		now := clk.Now()
+		next := s.next(now)
+		if next.IsZero() {
+			log.Printf("Schedule %q never fires\n", s)
+			return
+		}
+		clk.AfterFunc(next.Sub(now), func() {
+			onTick()
+			arm()
+		})
+	}
+	arm()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	ist, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"0 9 * * *", time.Date(2026, 1, 1, 3, 17, 0, 0, ist), time.Date(2026, 1, 1, 9, 0, 0, 0, ist)},
+		{"30 * * * *", time.Date(2026, 1, 1, 3, 45, 0, 0, ist), time.Date(2026, 1, 1, 4, 30, 0, 0, ist)},
+		{"@daily", time.Date(2026, 1, 1, 3, 17, 0, 0, time.UTC), time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1", time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		var s Schedule
+		if err := json.Unmarshal([]byte(`"`+tt.spec+`"`), &s); err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		if got := s.next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%s after %v = %v, want %v", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
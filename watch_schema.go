@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// newTreeDocument converts roots to the JSON output, whose model lives in
+// watchapi so backends can decode and produce it too.
+func newTreeDocument(roots []generatedRoot) watchapi.Document {
+	doc := watchapi.Document{
+		Version:     watchapi.SchemaVersion,
+		Generator:   currentBuildInfo().String(),
+		GeneratedAt: time.Now().UTC(),
+		Roots:       []watchapi.Root{},
+	}
+	for _, root := range roots {
+		doc.Roots = append(doc.Roots, watchapi.Root{
+			Directory: root.Dir,
+			Git:       root.Git,
+			Tree:      toSchemaNode(root.Tree, root.Dir, root.Dir, root.Dir),
+			Union:     root.Union,
+			Alias:     root.Alias,
+			Group:     root.Group,
+		})
+	}
+	return doc
+}
+
+// toSchemaNode converts the node at p under the root directory root.
+func toSchemaNode(node *treeNode, root, name, p string) *watchapi.Node {
+	n := &watchapi.Node{
+		ID:        watchapi.NodeID(root, p),
+		Name:      name,
+		Path:      p,
+		Kind:      "file",
+		Size:      node.Size,
+		ModTime:   node.ModTime,
+		Generated: node.Generated,
+		Pruned:    node.Pruned,
+		Origins:   node.Origins,
+		Note:      node.Note,
+		Tags:      node.Tags,
+	}
+	if node.IsDir {
+		n.Kind = "directory"
+		n.Size = 0
+		for _, child := range node.Children {
+			c := toSchemaNode(child, root, child.Name, joinSnapshotPath(rootPrefix(p), child.Name))
+			n.Size += c.Size
+			n.Children = append(n.Children, c)
+		}
+	}
+	if currentFormat() != (FormatConfig{}) {
+		n.Display = &watchapi.Display{Size: formatSize(n.Size), MTime: formatTime(n.ModTime)}
+	}
+	return n
+}
+
+func renderJSON(roots []generatedRoot) ([]byte, error) {
+	doc := newTreeDocument(roots)
+	redactDocument(&doc)
+	return json.MarshalIndent(doc, "", "  ")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// overlappingRoots are "." and "src", which both list src/x.ts.
+func overlappingRoots(size int64) []generatedRoot {
+	mtime := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	x := func() *treeNode { return &treeNode{Name: "x.ts", Size: size, ModTime: mtime} }
+	src := &treeNode{Name: "src", IsDir: true, ModTime: mtime, Children: []*treeNode{x()}}
+	return []generatedRoot{
+		{Dir: ".", Tree: &treeNode{Name: ".", IsDir: true, ModTime: mtime, Children: []*treeNode{src}}},
+		{Dir: "src", Tree: &treeNode{Name: "src", IsDir: true, ModTime: mtime, Children: []*treeNode{x()}}},
+	}
+}
+
+func TestNodeIDsUniqueAcrossRoots(t *testing.T) {
+	roots := overlappingRoots(10)
+	roots = append(roots, generatedRoot{Dir: "merged", Tree: roots[1].Tree, Union: []string{"src"}})
+	doc := newTreeDocument(roots)
+
+	seen := make(map[string]string)
+	var check func(root string, node *watchapi.Node)
+	check = func(root string, node *watchapi.Node) {
+		if other, ok := seen[node.ID]; ok {
+			t.Errorf("%s in %s has the ID of %s", node.Path, root, other)
+		}
+		seen[node.ID] = root + ":" + node.Path
+		for _, child := range node.Children {
+			check(root, child)
+		}
+	}
+	for _, root := range doc.Roots {
+		check(root.Directory, root.Tree)
+	}
+	if len(seen) != 7 {
+		t.Errorf("got %d IDs, want one for each of the 7 nodes", len(seen))
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// SectionConfig templates what the combined text output writes around
+// each root, using Go's text/template syntax with sectionData as the dot
+// and the functions size and time, which format like the tree does:
+//
+//	"sections": {"header": "=== {{.Title}}: {{.Files}} files, {{size .Size}} ===\n", "separator": "\n--- end {{.Title}} ---\n\n"}
+//
+// The "Directory:" or "File:" line still opens each tree, so `watch diff`
+// reads the output whatever the templates write. Templates using .Time
+// change the output on every generation, so it is always rewritten.
+type SectionConfig struct {
+	// Written before each root. Empty by default.
+	Header string `json:"header,omitempty"`
+	// Written after each root. Defaults to "\n---\n\n".
+	Separator string `json:"separator,omitempty"`
+	// Written before the first root of each group. Defaults to
+	// "Group: {{.Group}}\n\n".
+	Group string `json:"group,omitempty"`
+}
+
+const (
+	defaultSeparator   = "\n---\n\n"
+	defaultGroupHeader = "Group: {{.Group}}\n\n"
+)
+
+// sectionData is what section templates are executed with.
+type sectionData struct {
+	Directory string             // As configured
+	Title     string             // The alias, or else the directory
+	Group     string             // Empty for roots outside a group
+	Index     int                // Position among the roots, from 1
+	Count     int                // Number of roots
+	Files     int                // Files in the root, including pruned ones
+	Dirs      int                // Directories beneath the root, likewise
+	Size      int64              // Bytes in the files listed
+	Time      time.Time          // When the output was rendered
+	Git       *watchapi.GitState // Nil outside a git repository
+}
+
+var sectionFuncs = template.FuncMap{
+	"size": formatSize,
+	"time": formatTime,
+}
+
+type sectionTemplates struct {
+	header, separator, group *template.Template
+}
+
+func (s SectionConfig) parse() (sectionTemplates, error) {
+	var t sectionTemplates
+	for _, part := range []struct {
+		name, text string
+		dst        **template.Template
+	}{
+		{"header", s.Header, &t.header},
+		{"separator", cmp.Or(s.Separator, defaultSeparator), &t.separator},
+		{"group", cmp.Or(s.Group, defaultGroupHeader), &t.group},
+	} {
+		parsed, err := template.New(part.name).Funcs(sectionFuncs).Parse(part.text)
+		if err != nil {
+			return t, fmt.Errorf("invalid section %s: %w", part.name, err)
+		}
+		*part.dst = parsed
+	}
+	return t, nil
+}
+
+// validate reports templates that don't parse or fail on a sample root.
+func (s SectionConfig) validate() error {
+	t, err := s.parse()
+	if err != nil {
+		return err
+	}
+	sample := sectionData{Directory: "src", Title: "src", Index: 1, Count: 1, Time: time.Now()}
+	for _, tmpl := range []*template.Template{t.header, t.separator, t.group} {
+		if err := tmpl.Execute(new(strings.Builder), sample); err != nil {
+			return fmt.Errorf("invalid section %s: %w", tmpl.Name(), err)
+		}
+	}
+	return nil
+}
+
+// newSectionData describes the i-th of roots.
+func newSectionData(roots []generatedRoot, i int, now time.Time) sectionData {
+	root := roots[i]
+	files, dirs := countEntries(root.Tree)
+	if root.Tree.IsDir {
+		dirs-- // Not the root itself
+	}
+	return sectionData{
+		Directory: redactText(root.Dir),
+		Title:     redactText(root.title()),
+		Group:     redactText(root.Group),
+		Index:     i + 1,
+		Count:     len(roots),
+		Files:     files,
+		Dirs:      dirs,
+		Size:      totalSize(root.Tree),
+		Time:      now,
+		Git:       root.Git,
+	}
+}
+
+func totalSize(node *treeNode) int64 {
+	if !node.IsDir {
+		return node.Size
+	}
+	var size int64
+	for _, child := range node.Children {
+		size += totalSize(child)
+	}
+	return size
+}
+
+// executeSection writes a section, logging templates that fail.
+func executeSection(builder *strings.Builder, tmpl *template.Template, data sectionData) {
+	if err := tmpl.Execute(builder, data); err != nil {
+		log.Printf("Error rendering section %s for %s: %v\n", tmpl.Name(), data.Directory, err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// compileSelect compiles a --select pattern. Patterns use .gitignore syntax
+// and match slash-separated paths starting with the configured directory,
+// e.g. "src/app/**/page.tsx"; a pattern without a slash matches at any
+// depth.
+func compileSelect(pattern string) (gitPattern, error) {
+	p, ok := compileGitPattern(pattern)
+	if !ok || p.negate {
+		return p, fmt.Errorf("invalid select pattern %q", pattern)
+	}
+	return p, nil
+}
+
+// selectTree returns a copy of root holding only the nodes matching p and
+// their ancestors, or nil when nothing matches. A matching directory keeps
+// everything beneath it.
+func selectTree(rootDir string, root *treeNode, p gitPattern) *treeNode {
+	if !root.IsDir {
+		if p.match(filepath.ToSlash(rootDir), false) {
+			return root
+		}
+		return nil
+	}
+	var walk func(node *treeNode, path string) *treeNode
+	walk = func(node *treeNode, path string) *treeNode {
+		if path != "" && p.match(path, node.IsDir) {
+			return node
+		}
+		if !node.IsDir {
+			return nil
+		}
+		var children []*treeNode
+		for _, child := range node.Children {
+			if c := walk(child, joinSnapshotPath(path, child.Name)); c != nil {
+				children = append(children, c)
+			}
+		}
+		if children == nil {
+			return nil
+		}
+		copied := *node
+		copied.Children = children
+		return &copied
+	}
+	return walk(root, rootPrefix(filepath.ToSlash(rootDir)))
+}
+
+// selectSchemaNode is selectTree for the JSON document, keeping the nodes
+// for which keep is true. Directory sizes are recomputed from the files
+// kept.
+func selectSchemaNode(node *watchapi.Node, keep func(*watchapi.Node) bool) *watchapi.Node {
+	if keep(node) {
+		return node
+	}
+	if node.Kind != "directory" {
+		return nil
+	}
+	copied := *node
+	copied.Children, copied.Size = nil, 0
+	for _, child := range node.Children {
+		if c := selectSchemaNode(child, keep); c != nil {
+			copied.Children = append(copied.Children, c)
+			copied.Size += c.Size
+		}
+	}
+	if copied.Children == nil {
+		return nil
+	}
+	return &copied
+}
+
+// serveSelectedTrees answers GET /trees?select=<pattern> and
+// GET /trees?tag=<tag> from the latest document, keeping the roots in
+// which something matched. With both, entries must match both.
+func serveSelectedTrees(w http.ResponseWriter, r *http.Request) {
+	keep := func(*watchapi.Node) bool { return true }
+	if r.URL.Query().Has("select") {
+		p, err := compileSelect(r.URL.Query().Get("select"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		keep = func(n *watchapi.Node) bool { return p.match(n.Path, n.Kind == "directory") }
+	}
+	if r.URL.Query().Has("tag") {
+		tag, selected := r.URL.Query().Get("tag"), keep
+		keep = func(n *watchapi.Node) bool { return slices.Contains(n.Tags, tag) && selected(n) }
+	}
+	latestTrees.mu.RLock()
+	doc := latestTrees.doc
+	latestTrees.mu.RUnlock()
+	if doc == nil {
+		http.Error(w, "trees have not been generated yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	selected := *doc
+	selected.Roots = []watchapi.Root{}
+	for _, root := range doc.Roots {
+		if root.Tree == nil {
+			continue
+		}
+		if tree := selectSchemaNode(root.Tree, keep); tree != nil {
+			root.Tree = tree
+			selected.Roots = append(selected.Roots, root)
+		}
+	}
+	writeJSON(w, selected)
+}
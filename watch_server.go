@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// ServerConfig configures the HTTP API enabled by listen.
+type ServerConfig struct {
+	Auth AuthConfig `json:"auth,omitzero"`
+	TLS  TLSConfig  `json:"tls,omitzero"`
+	CORS CORSConfig `json:"cors,omitzero"`
+
+	// Per-client limit on /trees and /regenerate.
+	RateLimit RateLimitConfig `json:"rateLimit,omitzero"`
+
+	// Serve the net/http/pprof profiles under /debug/pprof/, behind the
+	// same auth as the API.
+	Pprof bool `json:"pprof,omitempty"`
+}
+
+// AuthConfig protects every endpoint with a bearer token, basic auth, or
+// either. Values may reference environment variables as "${NAME}".
+type AuthConfig struct {
+	Token    string `json:"token,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+func (a AuthConfig) enabled() bool {
+	return a.Token != "" || a.Username != ""
+}
+
+// requireAuth rejects requests that carry neither the configured token nor
+// the configured credentials.
+func requireAuth(auth AuthConfig, next http.Handler) http.Handler {
+	if !auth.enabled() {
+		return next
+	}
+	token := os.ExpandEnv(auth.Token)
+	username, password := os.ExpandEnv(auth.Username), os.ExpandEnv(auth.Password)
+	equal := func(a, b string) bool { return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1 }
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && equal(bearer, token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if username != "" {
+			if u, p, ok := r.BasicAuth(); ok && equal(u, username) && equal(p, password) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="watch"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="watch"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// CORSConfig lets browser apps on other origins, such as the dashboard
+// dev server on localhost:3000, call the API. "*" allows any origin, but
+// only without credentials; origins listed by name may send them.
+// Methods default to GET, POST and OPTIONS; headers to Authorization and
+// Content-Type.
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+	MaxAge         Duration `json:"maxAge,omitzero"`
+}
+
+// allowCORS adds CORS headers for allowed origins and answers preflight
+// requests itself, so they succeed without credentials.
+func allowCORS(cors CORSConfig, next http.Handler) http.Handler {
+	if len(cors.AllowedOrigins) == 0 {
+		return next
+	}
+	methods, headers := cors.AllowedMethods, cors.AllowedHeaders
+	if len(methods) == 0 {
+		methods = []string{"GET", "POST", "OPTIONS"}
+	}
+	if len(headers) == 0 {
+		headers = []string{"Authorization", "Content-Type"}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		listed := origin != "" && slices.Contains(cors.AllowedOrigins, origin)
+		if origin == "" || !listed && !slices.Contains(cors.AllowedOrigins, "*") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if listed {
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+		} else {
+			h.Set("Access-Control-Allow-Origin", "*")
+		}
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		if cors.MaxAge.Duration > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// treesHandler serves the latest JSON document at /trees once the server
+// is started; generateAllTrees keeps it current.
+var treesHandler *watchapi.Handler
+
+// Timeouts for reading a request, so slow clients can't hold connections
+// open. There's no write timeout: pprof profiles stream for as long as
+// they're asked to.
+const (
+	serverReadHeaderTimeout = 10 * time.Second
+	serverReadTimeout       = 30 * time.Second
+)
+
+// startServer serves the HTTP API on addr in the background.
+// POST /trees (or /regenerate) runs regenerate before responding, and
+// GET /trees?select=<pattern> and GET /trees?tag=<tag> return only the
+// matching paths.
+func startServer(addr string, server ServerConfig, idx *fileIndex, regenerate func()) {
+	treesHandler = watchapi.NewHandler(func() error {
+		regenerate()
+		return nil
+	})
+
+	limiter := newRateLimiter(server.RateLimit)
+	if limiter != nil {
+		go limiter.sweep()
+	}
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           apiHandler(server, idx, limiter),
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+	}
+	if server.TLS.enabled() {
+		cert, err := server.TLS.certificate()
+		if err != nil {
+			log.Fatalln("Error loading TLS certificate:", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	go func() {
+		var err error
+		if srv.TLSConfig != nil {
+			log.Printf("HTTPS API listening on %s\n", addr)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("HTTP API listening on %s\n", addr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
+			log.Println("HTTP server error:", err)
+		}
+	}()
+}
+
+// apiHandler routes the API. Every route, pprof included, counts against
+// the same per-client limit.
+func apiHandler(server ServerConfig, idx *fileIndex, limiter *rateLimiter) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		handleSearch(w, r, idx)
+	})
+	mux.Handle("/trees", treesHandler)
+	mux.HandleFunc("GET /trees", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("select") || r.URL.Query().Has("tag") {
+			serveSelectedTrees(w, r)
+			return
+		}
+		treesHandler.ServeHTTP(w, r)
+	})
+	mux.Handle("POST /regenerate", treesHandler)
+	mux.HandleFunc("GET /state", handleState)
+	if gql, err := newGraphQLHandler(idx); err != nil {
+		log.Println("Error parsing GraphQL schema:", err)
+	} else {
+		mux.Handle("POST /graphql", gql)
+	}
+
+	if server.Pprof {
+		handlePprof(mux)
+	}
+	return allowCORS(server.CORS, requireAuth(server.Auth, rateLimit(limiter, mux)))
+}
+
+func handleSearch(w http.ResponseWriter, r *http.Request, idx *fileIndex) {
+	if idx == nil {
+		http.Error(w, "index is not enabled", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "missing q parameter", http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("content") != "" {
+		handleGrep(w, query, idx)
+		return
+	}
+	results := idx.search(query)
+	for i := range results {
+		results[i].Root = redactText(results[i].Root)
+		results[i].Path = redactText(results[i].Path)
+	}
+	writeJSON(w, results)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error encoding response:", err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+const defaultShutdownGrace = 10 * time.Second
+
+func (c Config) shutdownGrace() time.Duration {
+	if c.ShutdownGrace.Duration <= 0 {
+		return defaultShutdownGrace
+	}
+	return c.ShutdownGrace.Duration
+}
+
+// drainChanges hands the events still settling to the worker, waits for
+// it to handle everything queued and, if that left changes unwritten,
+// runs one last generation. Digests are then sent rather than dropped.
+func drainChanges(flush chan<- chan struct{}, queue *changeQueue, gen *generator) {
+	reply := make(chan struct{})
+	flush <- reply
+	<-reply
+	queue.wait()
+	if stateDirty() {
+		log.Println("Writing pending changes before exiting...")
+		gen.generate()
+	}
+	flushDigests()
+}
+
+// shutDown runs drain until it finishes, grace runs out or another
+// signal arrives, whichever comes first.
+func shutDown(grace time.Duration, signals <-chan os.Signal, drain func()) {
+	done := make(chan struct{})
+	go func() {
+		drain()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(grace):
+		log.Printf("Pending work not finished after %s; exiting anyway.\n", grace)
+	case <-signals:
+		log.Println("Exiting without finishing pending work.")
+	}
+}
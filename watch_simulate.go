@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Scripted scenarios start at midnight on a Monday, so schedules fire at
+// the same offsets on every run.
+var simulationStart = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// readScenario reads a --simulate script. Each line is either an event
+// recorded by --record or "<offset> <op> <path>", where the offset is
+// from the start of the scenario, or from the line before when it begins
+// with "+":
+//
+//	0s      CREATE src/a.go
+//	+120ms  WRITE  src/a.go
+//	2s      REMOVE|RENAME src/b.go
+//
+// Blank lines and lines starting with # are skipped.
+func readScenario(file string) (start time.Time, events []recordedEvent, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return start, nil, err
+	}
+	defer f.Close()
+
+	start = simulationStart
+	last := start
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var e recordedEvent
+		if strings.HasPrefix(text, "{") {
+			if err := json.Unmarshal([]byte(text), &e); err != nil {
+				return start, nil, fmt.Errorf("%s:%d: %v", file, line, err)
+			}
+			if len(events) == 0 {
+				start = e.Time
+			}
+		} else {
+			fields := strings.Fields(text)
+			if len(fields) != 3 {
+				return start, nil, fmt.Errorf("%s:%d: want <offset> <op> <path>", file, line)
+			}
+			offset, relative := strings.CutPrefix(fields[0], "+")
+			d, err := time.ParseDuration(offset)
+			if err != nil {
+				return start, nil, fmt.Errorf("%s:%d: %v", file, line, err)
+			}
+			e = recordedEvent{Time: start.Add(d), Op: fields[1], Name: fields[2]}
+			if relative {
+				e.Time = last.Add(d)
+			}
+		}
+		if _, err := parseOp(e.Op); err != nil {
+			return start, nil, fmt.Errorf("%s:%d: %v", file, line, err)
+		}
+		if e.Time.Before(last) {
+			return start, nil, fmt.Errorf("%s:%d: events must be in time order", file, line)
+		}
+		last = e.Time
+		events = append(events, e)
+	}
+	return start, events, scanner.Err()
+}
+
+// runSimulate implements --simulate: it plays a scenario through the
+// event reader, task debouncing, the interval gate and the schedule of
+// the current config on a fake clock, and prints when each generation
+// and task would run. Nothing is watched, generated or executed, and
+// generations are taken to be instant.
+func runSimulate(file string) {
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Error loading %s: %v", configFileName, err)
+	}
+	configureIgnores(config)
+	start, scenario, err := readScenario(file)
+	if err != nil {
+		log.Fatalf("Error reading scenario: %v", err)
+	}
+
+	fake := newFakeClock(start)
+	clk = fake
+	files := scenarioFS{fileSystem: fsys, present: make(map[string]bool)}
+	fsys = files
+	log.SetOutput(io.Discard)
+	at := func(format string, args ...any) {
+		fmt.Printf("%+9.3fs  "+format+"\n", append([]any{fake.Now().Sub(start).Seconds()}, args...)...)
+	}
+
+	generations, taskRuns := 0, 0
+	regenerate := func(why string) {
+		generations++
+		at("regenerate  %s", why)
+	}
+	tasks := newTaskRunner(config.OnChange)
+	tasks.onRun = func(rule OnChangeRule) {
+		taskRuns++
+		at("task        %s (%s)", strings.Join(rule.Command, " "), rule.Pattern)
+	}
+	var gate *intervalGate
+	if config.Interval.Duration > 0 {
+		gate = newIntervalGate(config.Interval.Duration, func() { regenerate("interval tick") })
+	}
+	startSchedule(config.Schedule, func() { regenerate("schedule") })
+
+	settle := config.settleTime()
+	reader := newEventReader(settle, gitDirs(config.Directories), func() []string { return config.Directories }, tasks, func(batch changeBatch) {
+		paths := plural(len(batch.changed)+len(batch.movedRepos), "path")
+		switch {
+		case !batch.structural():
+			at("settled     %s, none structural", paths)
+		case gate != nil:
+			gate.mark()
+			at("settled     %s; dirty until the next interval tick", paths)
+		default:
+			regenerate(paths + " settled")
+		}
+		for _, pair := range batch.renames {
+			at("renamed     %s -> %s", pair.from, pair.to)
+		}
+	})
+	reader.note = func(event fsnotify.Event, what string) {
+		at("%-11s %s: %s", event.Op, event.Name, what)
+	}
+
+	for _, e := range scenario {
+		fake.advanceTo(e.Time)
+		event := e.event()
+		files.apply(event)
+		reader.handle(event)
+	}
+
+	// Run until everything the last event set off has happened.
+	end := fake.Now().Add(settle + config.Interval.Duration)
+	for _, rule := range config.OnChange {
+		end = end.Add(max(rule.Debounce.Duration, defaultTaskDebounce))
+	}
+	fake.advanceTo(end)
+	fmt.Printf("%s, %s, %s\n", plural(len(scenario), "event"), plural(generations, "generation"), plural(taskRuns, "task run"))
+}
+
+// scenarioFS answers whether the paths a scenario touched exist from its
+// events, so renames pair the same way on every machine, and reads
+// everything else, such as ignore files, from the filesystem it wraps.
+// Rename is taken as the old name's half, as fsnotify reports it.
+type scenarioFS struct {
+	fileSystem
+	present map[string]bool // By cleaned path, for the paths events touched
+}
+
+func (s scenarioFS) apply(event fsnotify.Event) {
+	name := filepath.Clean(event.Name)
+	switch {
+	case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+		s.present[name] = false
+	case event.Has(fsnotify.Create) || event.Has(fsnotify.Write):
+		s.present[name] = true
+	}
+}
+
+func (s scenarioFS) Stat(name string) (fs.FileInfo, error) {
+	if present, ok := s.present[filepath.Clean(name)]; ok {
+		return scenarioStat("stat", name, present)
+	}
+	return s.fileSystem.Stat(name)
+}
+
+func (s scenarioFS) Lstat(name string) (fs.FileInfo, error) {
+	if present, ok := s.present[filepath.Clean(name)]; ok {
+		return scenarioStat("lstat", name, present)
+	}
+	return s.fileSystem.Lstat(name)
+}
+
+func scenarioStat(op, name string, present bool) (fs.FileInfo, error) {
+	if !present {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return scenarioFile(filepath.Base(name)), nil
+}
+
+// scenarioFile describes a file a scenario created.
+type scenarioFile string
+
+func (f scenarioFile) Name() string     { return string(f) }
+func (scenarioFile) Size() int64        { return 0 }
+func (scenarioFile) Mode() fs.FileMode  { return 0o644 }
+func (scenarioFile) ModTime() time.Time { return simulationStart }
+func (scenarioFile) IsDir() bool        { return false }
+func (scenarioFile) Sys() any           { return nil }
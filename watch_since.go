@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// runTree implements `watch tree [--since <ref>] [--select <pattern>]`: it
+// prints the trees once to stdout. With --since only files changed relative
+// to the git ref, plus untracked ones, are shown, nested in their
+// directories. With --select only paths matching the pattern are shown,
+// along with their ancestors.
+func runTree(args []string) {
+	fs := flag.NewFlagSet("tree", flag.ExitOnError)
+	since := fs.String("since", "", "Only show files changed relative to this git ref")
+	selectPattern := fs.String("select", "", "Only show paths matching this pattern, e.g. 'src/app/**/page.tsx'")
+	fs.BoolVar(&plainOutput, "plain", false, "Plain output: ASCII connectors and no build header")
+	redactFlag := fs.Bool("redact", false, "Replace the home directory and the configured redact segments")
+	profiles := addProfileFlags(fs)
+	fs.Parse(args)
+	defer profiles.start()()
+
+	var sel gitPattern
+	if *selectPattern != "" {
+		var err error
+		if sel, err = compileSelect(*selectPattern); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Error loading %s: %v", configFileName, err)
+	}
+	configureIgnores(config)
+	if *redactFlag {
+		enableRedaction(config.Redact)
+	}
+
+	var roots []generatedRoot
+	for _, dir := range config.Directories {
+		var tree *treeNode
+		if *since == "" {
+			tree, err = buildTree(context.Background(), dir)
+		} else if isRemoteRoot(dir) {
+			log.Printf("Skipping remote root %s\n", dir)
+			continue
+		} else {
+			tree, err = changedTree(dir, *since)
+		}
+		if err != nil {
+			log.Fatalf("Error building tree for %s: %v", dir, err)
+		}
+		if tree != nil && *selectPattern != "" {
+			tree = selectTree(dir, tree, sel)
+		}
+		if tree != nil {
+			roots = append(roots, generatedRoot{Dir: dir, Tree: tree, Git: readGitState(dir)})
+		}
+	}
+	os.Stdout.Write([]byte(renderText(roots, config.Render)))
+}
+
+// changedTree builds a tree of the files under rootDir that differ from
+// ref, or nil for a file root that hasn't changed.
+func changedTree(rootDir, ref string) (*treeNode, error) {
+	if isFileRoot(rootDir) {
+		dir, name := filepath.Split(rootDir)
+		if dir == "" {
+			dir = "."
+		}
+		changed, err := changedFiles(dir, ref, name)
+		if err != nil || len(changed) == 0 {
+			return nil, err
+		}
+		return buildLocalTree(context.Background(), rootDir)
+	}
+
+	changed, err := changedFiles(rootDir, ref, ".")
+	if err != nil {
+		return nil, err
+	}
+	root := &treeNode{Name: rootDir, IsDir: true}
+	for _, rel := range changed {
+		path := filepath.Join(rootDir, filepath.FromSlash(rel))
+		if isIgnored(path) {
+			continue
+		}
+		info, err := fsys.Stat(path)
+		if err != nil || info.IsDir() {
+			continue // Deleted since ref
+		}
+		insertPath(root, rel, &treeNode{Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sortTree(root)
+	return root, nil
+}
+
+// changedFiles lists the files under pathspec, relative to dir, that differ
+// between ref and the working tree or are untracked.
+func changedFiles(dir, ref, pathspec string) ([]string, error) {
+	diff := exec.Command("git", "diff", "-z", "--name-only", "--relative", ref, "--", pathspec)
+	diff.Dir = dir
+	tracked, err := diff.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s: %w", ref, err)
+	}
+	others := exec.Command("git", "ls-files", "-z", "--others", "--exclude-standard", "--", pathspec)
+	others.Dir = dir
+	untracked, err := others.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+
+	var files []string
+	for _, out := range [][]byte{tracked, untracked} {
+		for _, name := range bytes.Split(out, []byte{0}) {
+			if len(name) > 0 {
+				files = append(files, string(name))
+			}
+		}
+	}
+	return files, nil
+}
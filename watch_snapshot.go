@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runSnapshot implements `watch snapshot --zip out.zip`: it archives the
+// files in the trees of the local roots together with the text tree as a
+// manifest.
+func runSnapshot(args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	zipPath := fs.String("zip", "", "Write the snapshot to this zip file")
+	fs.Parse(args)
+	if *zipPath == "" {
+		log.Fatal("Usage: watch snapshot --zip out.zip")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Error loading %s: %v", configFileName, err)
+	}
+	configureIgnores(config)
+
+	count, err := writeSnapshotZip(*zipPath, config)
+	if err != nil {
+		log.Fatalf("Error writing %s: %v", *zipPath, err)
+	}
+	fmt.Printf("Wrote %d files to %s\n", count, *zipPath)
+}
+
+func writeSnapshotZip(zipPath string, config Config) (int, error) {
+	out, err := os.Create(zipPath)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	zipAbs := absPath(zipPath)
+
+	zw := zip.NewWriter(out)
+	var roots []generatedRoot
+	var dirs []string
+	for _, dir := range config.Directories {
+		if isRemoteRoot(dir) {
+			log.Printf("Skipping remote root %s\n", dir)
+			continue
+		}
+		tree, err := buildLocalTree(context.Background(), dir)
+		if err != nil {
+			return 0, err
+		}
+		roots = append(roots, generatedRoot{Dir: dir, Tree: tree, Git: readGitState(dir)})
+		dirs = append(dirs, dir)
+	}
+
+	// The archive holds the files of the trees in the manifest, so the
+	// ignore, generated-file and MIME rules apply to both alike.
+	count := 0
+	var add func(path, name string, node *treeNode) error
+	add = func(path, name string, node *treeNode) error {
+		if node.IsDir {
+			for _, child := range node.Children {
+				if err := add(filepath.Join(path, child.Name), name+"/"+child.Name, child); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if !node.Mode.IsRegular() || node.Summarized || absPath(path) == zipAbs {
+			return nil
+		}
+		count++
+		return addZipFile(zw, path, name, node)
+	}
+	for i, prefix := range snapshotPrefixes(dirs) {
+		if err := add(roots[i].Dir, prefix, roots[i].Tree); err != nil {
+			return count, err
+		}
+	}
+
+	manifest, err := zw.CreateHeader(&zip.FileHeader{Name: outputFileName, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return count, err
+	}
+	if _, err := io.WriteString(manifest, renderText(roots, config.Render)); err != nil {
+		return count, err
+	}
+	if err := zw.Close(); err != nil {
+		return count, err
+	}
+	return count, out.Close()
+}
+
+// snapshotPrefixes names the archive directory of each root after its base
+// name, numbering repeats: "src", "src-2".
+func snapshotPrefixes(dirs []string) []string {
+	prefixes := make([]string, len(dirs))
+	used := make(map[string]bool)
+	for i, dir := range dirs {
+		base := filepath.Base(absPath(dir))
+		prefix := base
+		for n := 2; used[prefix]; n++ {
+			prefix = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[prefix] = true
+		prefixes[i] = prefix
+	}
+	return prefixes
+}
+
+func addZipFile(zw *zip.Writer, path, name string, node *treeNode) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: node.ModTime}
+	header.SetMode(node.Mode)
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
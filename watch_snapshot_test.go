@@ -0,0 +1,49 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWriteSnapshotZip(t *testing.T) {
+	base := t.TempDir()
+	files := map[string]string{
+		"a/src/index.ts":   "export {}",
+		"a/src/gen.ts":     "// generated",
+		"a/.git/HEAD":      "ref: refs/heads/main\n",
+		"a/.gitattributes": "gen.ts linguist-generated\n",
+		"b/src/main.go":    "package main",
+	}
+	for name, data := range files {
+		path := filepath.Join(base, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := Config{Directories: []string{filepath.Join(base, "a", "src"), filepath.Join(base, "b", "src")}}
+	configureIgnores(config)
+	defer configureIgnores(Config{})
+
+	zipPath := filepath.Join(base, "out.zip")
+	if _, err := writeSnapshotZip(zipPath, config); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	slices.Sort(names)
+	want := []string{outputFileName, "src-2/main.go", "src/index.ts"}
+	if !slices.Equal(names, want) {
+		t.Errorf("archive holds %q, want %q", names, want)
+	}
+}
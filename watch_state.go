@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateFileName records where the daemon left off, so a restart after a
+// crash knows whether the outputs are stale.
+const stateFileName = ".watch-state.json"
+
+type daemonState struct {
+	LastGeneration time.Time `json:"lastGeneration,omitzero"`
+	// Hash of what each output last received, keyed like lastWritten.
+	Outputs map[string]string `json:"outputs,omitempty"`
+	// Roots whose tree failed in the last generation, with the error.
+	RootErrors map[string]string `json:"rootErrors,omitempty"`
+	// Changes were seen that no finished generation has written yet.
+	Dirty bool `json:"dirty"`
+}
+
+var (
+	stateMu sync.Mutex
+	state   daemonState
+	// Counts the batches marked dirty, so a generation that started
+	// before the latest change doesn't mark the state clean.
+	changeSeq uint64
+)
+
+// loadState restores the state saved by the last run and reports what it
+// left unfinished.
+func loadState() {
+	data, err := os.ReadFile(stateFileName)
+	if os.IsNotExist(err) {
+		return
+	}
+	var saved daemonState
+	if err == nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	if err != nil {
+		log.Printf("Error reading %s: %v\n", stateFileName, err)
+		return
+	}
+
+	if saved.Dirty {
+		log.Println("Changes were pending when the last run stopped; the outputs are stale until the first generation.")
+	}
+	for dir, msg := range saved.RootErrors {
+		log.Printf("%s failed in the last run: %s\n", dir, msg)
+	}
+	lastWrittenMu.Lock()
+	for key, sum := range saved.Outputs {
+		// A new run always prints to the console.
+		if strings.HasPrefix(key, stdoutSink{}.String()+"\x00") {
+			continue
+		}
+		var digest [sha256.Size]byte
+		if b, err := hex.DecodeString(sum); err == nil && len(b) == len(digest) {
+			copy(digest[:], b)
+			lastWritten[key] = digest
+		}
+	}
+	lastWrittenMu.Unlock()
+
+	stateMu.Lock()
+	state = saved
+	stateMu.Unlock()
+}
+
+// markDirty records that changes are waiting for a generation.
+func markDirty() {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	changeSeq++
+	if !state.Dirty {
+		state.Dirty = true
+		saveState()
+	}
+}
+
+// stateDirty reports whether changes are waiting for a generation.
+func stateDirty() bool {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return state.Dirty
+}
+
+// beginGeneration returns the change count a generation starting now
+// covers.
+func beginGeneration() uint64 {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return changeSeq
+}
+
+// finishGeneration records a completed generation that started at seq.
+func finishGeneration(seq uint64, rootErrors map[string]string) {
+	lastWrittenMu.Lock()
+	outputs := make(map[string]string, len(lastWritten))
+	for key, sum := range lastWritten {
+		outputs[key] = hex.EncodeToString(sum[:])
+	}
+	lastWrittenMu.Unlock()
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	state.LastGeneration = time.Now()
+	state.Outputs = outputs
+	state.RootErrors = rootErrors
+	if seq == changeSeq {
+		state.Dirty = false
+	}
+	saveState()
+}
+
+// saveState writes the state; stateMu must be held.
+func saveState() {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		log.Printf("Error writing %s: %v\n", stateFileName, err)
+		return
+	}
+	tmp := stateFileName + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("Error writing %s: %v\n", stateFileName, err)
+		return
+	}
+	if err := os.Rename(tmp, stateFileName); err != nil {
+		log.Printf("Error writing %s: %v\n", stateFileName, err)
+	}
+}
+
+// handleState serves the current state at GET /state.
+func handleState(w http.ResponseWriter, r *http.Request) {
+	stateMu.Lock()
+	data, err := json.MarshalIndent(state, "", "  ")
+	stateMu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
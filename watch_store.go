@@ -0,0 +1,221 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// storeSchema keeps the current files, one row per generation, and what
+// each generation changed. Paths are unique within a root; overlapping
+// roots such as "." and "src" both list src's files. For example, when a
+// directory first appeared:
+//
+//	SELECT g.generated_at FROM changes c JOIN generations g ON g.id = c.generation
+//	WHERE c.root = '.' AND c.path = 'src/app/admin' AND c.change = 'added'
+//	ORDER BY g.id LIMIT 1;
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS generations (
+	id           INTEGER PRIMARY KEY,
+	generated_at TEXT NOT NULL,
+	files        INTEGER NOT NULL,
+	dirs         INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS files (
+	root       TEXT NOT NULL,
+	path       TEXT NOT NULL,
+	type       TEXT NOT NULL,
+	size       INTEGER NOT NULL,
+	mtime      TEXT NOT NULL,
+	first_seen INTEGER NOT NULL REFERENCES generations(id),
+	PRIMARY KEY (root, path)
+);
+CREATE TABLE IF NOT EXISTS changes (
+	generation INTEGER NOT NULL REFERENCES generations(id),
+	root       TEXT NOT NULL,
+	path       TEXT NOT NULL,
+	change     TEXT NOT NULL -- "added", "modified" or "removed"
+);
+CREATE INDEX IF NOT EXISTS changes_path ON changes(path);
+PRAGMA user_version = 1;
+`
+
+// storeMigration brings a database written before files were keyed by
+// root up to storeSchema. Its changes get their root from the files
+// still present, or "" for removed ones.
+const storeMigration = `
+ALTER TABLE files RENAME TO files_v0;
+ALTER TABLE changes RENAME TO changes_v0;
+DROP INDEX IF EXISTS changes_path;
+` + storeSchema + `
+INSERT INTO files (root, path, type, size, mtime, first_seen)
+	SELECT root, path, type, size, mtime, first_seen FROM files_v0;
+INSERT INTO changes (generation, root, path, change)
+	SELECT c.generation, COALESCE(f.root, ''), c.path, c.change
+	FROM changes_v0 c LEFT JOIN files_v0 f ON f.path = c.path;
+DROP TABLE files_v0;
+DROP TABLE changes_v0;
+`
+
+// metadataStore records generations in a SQLite database. Each generation
+// only writes the rows that differ from the previous one.
+type metadataStore struct {
+	db *sql.DB
+}
+
+// store is the database configured by the database setting, if any.
+var store *metadataStore
+
+func openMetadataStore(path string) (*metadataStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		db.Close()
+		return nil, err
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'files'`).Scan(&tables); err != nil {
+		db.Close()
+		return nil, err
+	}
+	schema := storeSchema
+	if version == 0 && tables > 0 {
+		schema = storeMigration
+	}
+	if err := execTx(db, schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating tables: %w", err)
+	}
+	return &metadataStore{db: db}, nil
+}
+
+// execTx runs statements in a single transaction.
+func execTx(db *sql.DB, statements string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(statements); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// storeIgnores returns the names of the database and its journal files.
+func storeIgnores(path string) []string {
+	name := filepath.Base(path)
+	return []string{name, name + "-journal", name + "-wal", name + "-shm"}
+}
+
+// record adds a generation for roots.
+func (s *metadataStore) record(roots []generatedRoot) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type key struct{ root, path string }
+	type row struct {
+		size  int64
+		mtime string
+	}
+	existing := make(map[key]row)
+	rows, err := tx.Query(`SELECT root, path, size, mtime FROM files`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var k key
+		var r row
+		if err := rows.Scan(&k.root, &k.path, &r.size, &r.mtime); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[k] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	records := fileRecords(roots)
+	var files, dirs int
+	for _, record := range records {
+		if record.Type == "directory" {
+			dirs++
+		} else {
+			files++
+		}
+	}
+	result, err := tx.Exec(`INSERT INTO generations (generated_at, files, dirs) VALUES (?, ?, ?)`,
+		time.Now().UTC().Format(time.RFC3339), files, dirs)
+	if err != nil {
+		return err
+	}
+	generation, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	change := func(k key, kind string) error {
+		_, err := tx.Exec(`INSERT INTO changes (generation, root, path, change) VALUES (?, ?, ?, ?)`, generation, k.root, k.path, kind)
+		return err
+	}
+	// A root configured twice lists its files twice; they are one row.
+	seen := make(map[key]bool)
+	for _, record := range records {
+		k := key{record.Root, record.Path}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		mtime := record.ModTime.UTC().Format(time.RFC3339Nano)
+		old, ok := existing[k]
+		delete(existing, k)
+		switch {
+		case !ok:
+			_, err = tx.Exec(`INSERT INTO files (root, path, type, size, mtime, first_seen) VALUES (?, ?, ?, ?, ?, ?)`,
+				k.root, k.path, record.Type, record.Size, mtime, generation)
+			if err == nil {
+				err = change(k, "added")
+			}
+		case old.size != record.Size || old.mtime != mtime:
+			_, err = tx.Exec(`UPDATE files SET type = ?, size = ?, mtime = ? WHERE root = ? AND path = ?`,
+				record.Type, record.Size, mtime, k.root, k.path)
+			if err == nil {
+				err = change(k, "modified")
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for k := range existing {
+		if _, err := tx.Exec(`DELETE FROM files WHERE root = ? AND path = ?`, k.root, k.path); err != nil {
+			return err
+		}
+		if err := change(k, "removed"); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// recordGeneration stores roots in the configured database, if any.
+func recordGeneration(roots []generatedRoot) {
+	if store == nil {
+		return
+	}
+	if err := store.record(roots); err != nil {
+		log.Printf("Error recording generation in database: %v\n", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreOverlappingRoots(t *testing.T) {
+	s, err := openMetadataStore(filepath.Join(t.TempDir(), "watch.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.db.Close()
+
+	if err := s.record(overlappingRoots(10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.record(overlappingRoots(20)); err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	if err := s.db.QueryRow(`SELECT count(*) FROM files WHERE path = 'src/x.ts' AND size = 20`).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 2 {
+		t.Errorf("src/x.ts has %d current rows, want one per root", rows)
+	}
+	var modified int
+	if err := s.db.QueryRow(`SELECT count(*) FROM changes WHERE path = 'src/x.ts' AND change = 'modified'`).Scan(&modified); err != nil {
+		t.Fatal(err)
+	}
+	if modified != 2 {
+		t.Errorf("recorded %d modifications of src/x.ts, want one per root", modified)
+	}
+}
+
+func TestStoreMigratesPathKeyedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watch.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+CREATE TABLE generations (id INTEGER PRIMARY KEY, generated_at TEXT NOT NULL, files INTEGER NOT NULL, dirs INTEGER NOT NULL);
+CREATE TABLE files (path TEXT PRIMARY KEY, root TEXT NOT NULL, type TEXT NOT NULL, size INTEGER NOT NULL, mtime TEXT NOT NULL, first_seen INTEGER NOT NULL REFERENCES generations(id));
+CREATE TABLE changes (generation INTEGER NOT NULL REFERENCES generations(id), path TEXT NOT NULL, change TEXT NOT NULL);
+CREATE INDEX changes_path ON changes(path);
+INSERT INTO generations VALUES (1, '2024-03-01T12:00:00Z', 1, 0);
+INSERT INTO files VALUES ('src/x.ts', 'src', 'file', 10, '2024-03-01T12:00:00Z', 1);
+INSERT INTO changes VALUES (1, 'src/x.ts', 'added');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := openMetadataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.db.Close()
+	var root string
+	if err := s.db.QueryRow(`SELECT root FROM changes WHERE path = 'src/x.ts'`).Scan(&root); err != nil {
+		t.Fatal(err)
+	}
+	if root != "src" {
+		t.Errorf("migrated change has root %q, want src", root)
+	}
+	if err := s.record(overlappingRoots(10)); err != nil {
+		t.Errorf("recording after the migration: %v", err)
+	}
+}
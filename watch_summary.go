@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Number of directories listed in the "Largest directories" section.
+const largestDirCount = 5
+
+// Files bigger than this are counted but not scanned for line counts.
+const maxLineCountSize = 2 << 20
+
+// Maps file extensions to the language name shown in the summary.
+var languageByExt = map[string]string{
+	".ts":      "TypeScript",
+	".tsx":     "TypeScript",
+	".js":      "JavaScript",
+	".jsx":     "JavaScript",
+	".mjs":     "JavaScript",
+	".cjs":     "JavaScript",
+	".go":      "Go",
+	".css":     "CSS",
+	".scss":    "CSS",
+	".html":    "HTML",
+	".json":    "JSON",
+	".md":      "Markdown",
+	".mdc":     "Markdown",
+	".yml":     "YAML",
+	".yaml":    "YAML",
+	".toml":    "TOML",
+	".tf":      "Terraform",
+	".nix":     "Nix",
+	".py":      "Python",
+	".rs":      "Rust",
+	".sh":      "Shell",
+	".sql":     "SQL",
+	".graphql": "GraphQL",
+	".gql":     "GraphQL",
+	".rules":   "Firebase Rules",
+}
+
+type languageStats struct {
+	name  string
+	files int
+	lines int
+}
+
+type dirStats struct {
+	path  string
+	files int
+	lines int
+}
+
+// generateSummary describes the composition of tree, built from rootDir:
+// files and lines per language, the largest top-level directories, and
+// how many files are tests compared to regular source. It counts what the
+// tree lists, so ignored, excluded and linguist-generated files left out
+// of the tree are left out of the summary too.
+func generateSummary(ctx context.Context, rootDir string, tree *treeNode) (string, error) {
+	languages := make(map[string]*languageStats)
+	dirs := make(map[string]*dirStats)
+	var totalFiles, totalLines, testFiles, sourceFiles int
+
+	var visit func(node *treeNode, path, top string) error
+	visit = func(node *treeNode, path, top string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if node.IsDir {
+			for _, child := range node.Children {
+				childTop := top
+				if node == tree {
+					childTop = "."
+					if child.IsDir {
+						childTop = child.Name
+					}
+				}
+				if err := visit(child, filepath.Join(path, child.Name), childTop); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		lines := countLines(path, node.Size)
+		totalFiles++
+		totalLines += lines
+
+		lang, ok := languageByExt[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			lang = "Other"
+		} else if isTestFile(path) {
+			testFiles++
+		} else {
+			sourceFiles++
+		}
+		if languages[lang] == nil {
+			languages[lang] = &languageStats{name: lang}
+		}
+		languages[lang].files++
+		languages[lang].lines += lines
+
+		if dirs[top] == nil {
+			dirs[top] = &dirStats{path: top}
+		}
+		dirs[top].files++
+		dirs[top].lines += lines
+		return nil
+	}
+	if err := visit(tree, rootDir, "."); err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	builder.WriteString("Summary:\n")
+	builder.WriteString(fmt.Sprintf("  Total: %d files, %d lines\n", totalFiles, totalLines))
+
+	builder.WriteString("  Languages:\n")
+	langList := make([]*languageStats, 0, len(languages))
+	for _, l := range languages {
+		langList = append(langList, l)
+	}
+	sort.Slice(langList, func(i, j int) bool {
+		if langList[i].lines != langList[j].lines {
+			return langList[i].lines > langList[j].lines
+		}
+		return langList[i].name < langList[j].name
+	})
+	for _, l := range langList {
+		builder.WriteString(fmt.Sprintf("    %-16s %6d files %9d lines\n", l.name, l.files, l.lines))
+	}
+
+	builder.WriteString("  Largest directories:\n")
+	dirList := make([]*dirStats, 0, len(dirs))
+	for _, d := range dirs {
+		dirList = append(dirList, d)
+	}
+	sort.Slice(dirList, func(i, j int) bool {
+		if dirList[i].files != dirList[j].files {
+			return dirList[i].files > dirList[j].files
+		}
+		return dirList[i].path < dirList[j].path
+	})
+	if len(dirList) > largestDirCount {
+		dirList = dirList[:largestDirCount]
+	}
+	for _, d := range dirList {
+		builder.WriteString(fmt.Sprintf("    %-30s %6d files %9d lines\n", d.path, d.files, d.lines))
+	}
+
+	ratio := 0.0
+	if sourceFiles > 0 {
+		ratio = float64(testFiles) / float64(sourceFiles)
+	}
+	builder.WriteString(fmt.Sprintf("  Tests: %d test files, %d source files (ratio %.2f)\n", testFiles, sourceFiles, ratio))
+
+	return builder.String(), nil
+}
+
+// isTestFile reports whether path looks like a test by the naming
+// conventions used across JS/TS and Go projects.
+func isTestFile(path string) bool {
+	name := filepath.Base(path)
+	if strings.Contains(name, ".test.") || strings.Contains(name, ".spec.") || strings.HasSuffix(name, "_test.go") {
+		return true
+	}
+	dir := filepath.ToSlash(filepath.Dir(path))
+	return slices.Contains(strings.Split(dir, "/"), "__tests__")
+}
+
+// countLines returns the number of lines in a text file of size bytes.
+// Binary and very large files report zero.
+func countLines(path string, size int64) int {
+	if size == 0 || size > maxLineCountSize {
+		return 0
+	}
+	data, err := fsys.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return 0 // A symlink's target may be empty
+	}
+	if bytes.IndexByte(data, 0) != -1 {
+		return 0
+	}
+	lines := bytes.Count(data, []byte("\n"))
+	if data[len(data)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestIsTestFile(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"__tests__/simple.test.js", true},
+		{"__tests__/helpers.ts", true},
+		{"src/components/ui/__tests__/setup.ts", true},
+		{"src/lib/money.ts", false},
+		{"src/lib/money.test.ts", true},
+		{"watch_tree_test.go", true},
+		{"src/not__tests__/x.ts", false},
+	}
+	for _, tt := range tests {
+		if got := isTestFile(tt.path); got != tt.want {
+			t.Errorf("isTestFile(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// tagRule labels the entries matching a .gitignore-style pattern.
+type tagRule struct {
+	pattern gitPattern
+	tag     string
+}
+
+// tagRules is set from the config's tags.
+var tagRules []tagRule
+
+// Tags are rendered as " [tag]", so they may not contain spaces,
+// brackets or colons, which would read as entry metadata.
+var validTag = regexp.MustCompile(`^[^\s:\[\]]+$`)
+
+// entryTagsSuffix matches the tags trailing an entry in the text output.
+var entryTagsSuffix = regexp.MustCompile(`(?: \[[^\s:\[\]]+\])+$`)
+
+func setTags(tags map[string]string) {
+	var rules []tagRule
+	patterns := make([]string, 0, len(tags))
+	for pattern := range tags {
+		patterns = append(patterns, pattern)
+	}
+	slices.Sort(patterns)
+	for _, pattern := range patterns {
+		tag := strings.Trim(strings.TrimSpace(tags[pattern]), "[]")
+		if !validTag.MatchString(tag) {
+			log.Printf("Error: invalid tag %q for %s\n", tags[pattern], pattern)
+			continue
+		}
+		p, ok := compileGitPattern(pattern)
+		if !ok || p.negate {
+			log.Printf("Error: invalid tag pattern %q\n", pattern)
+			continue
+		}
+		rules = append(rules, tagRule{p, tag})
+	}
+	settingsMu.Lock()
+	tagRules = rules
+	settingsMu.Unlock()
+}
+
+// currentTagRules returns the tagRules in effect.
+func currentTagRules() []tagRule {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return tagRules
+}
+
+// annotateTags tags the entries of tree matching the config's rules.
+// Patterns match paths relative to rootDir, or starting with it as
+// configured.
+func annotateTags(rootDir string, tree *treeNode) {
+	rules := currentTagRules()
+	if len(rules) == 0 {
+		return
+	}
+	prefix := strings.Trim(path.Clean(strings.ReplaceAll(rootDir, `\`, "/")), "/")
+	var walk func(node *treeNode, rel string)
+	walk = func(node *treeNode, rel string) {
+		for _, child := range node.Children {
+			p := path.Join(rel, child.Name)
+			child.Tags = nil
+			for _, rule := range rules {
+				if slices.Contains(child.Tags, rule.tag) {
+					continue
+				}
+				if rule.pattern.match(p, child.IsDir) || rule.pattern.match(path.Join(prefix, p), child.IsDir) {
+					child.Tags = append(child.Tags, rule.tag)
+				}
+			}
+			slices.Sort(child.Tags)
+			walk(child, p)
+		}
+	}
+	walk(tree, "")
+}
+
+// tagsLabel is how an entry's tags follow its name in the text output.
+func tagsLabel(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(tags, "] [") + "]"
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OnChangeRule runs a command whenever files matching Pattern change, e.g.
+// "*.graphql" → codegen. Patterns without a slash match base names; others
+// match the slash-separated path relative to the watched root.
+type OnChangeRule struct {
+	Pattern  string   `json:"pattern"`
+	Command  []string `json:"command"`
+	Debounce Duration `json:"debounce,omitzero"` // Defaults to 500ms
+}
+
+const defaultTaskDebounce = 500 * time.Millisecond
+
+func (r OnChangeRule) matches(root, path string) bool {
+	if !strings.Contains(r.Pattern, "/") {
+		matched, _ := filepath.Match(r.Pattern, filepath.Base(path))
+		return matched
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	matched, _ := filepath.Match(r.Pattern, filepath.ToSlash(rel))
+	return matched
+}
+
+// task is the runtime state of one rule. Each has its own debounce timer,
+// and runs of the same task never overlap.
+type task struct {
+	rule  OnChangeRule
+	timer clockTimer
+	run   sync.Mutex
+}
+
+type taskRunner struct {
+	mu    sync.Mutex
+	tasks []*task
+	// Replaces running the command, for --simulate.
+	onRun func(rule OnChangeRule)
+}
+
+func newTaskRunner(rules []OnChangeRule) *taskRunner {
+	r := &taskRunner{}
+	for _, rule := range rules {
+		if rule.Pattern == "" || len(rule.Command) == 0 {
+			log.Printf("Skipping onChange rule without a pattern or command: %+v\n", rule)
+			continue
+		}
+		r.tasks = append(r.tasks, &task{rule: rule})
+	}
+	return r
+}
+
+// notify schedules every task whose pattern matches path.
+func (r *taskRunner) notify(root, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tasks {
+		if !t.rule.matches(root, path) {
+			continue
+		}
+		debounce := t.rule.Debounce.Duration
+		if debounce <= 0 {
+			debounce = defaultTaskDebounce
+		}
+		if t.timer == nil {
+			t.timer = clk.AfterFunc(debounce, func() { r.execute(t) })
+		} else {
+			t.timer.Reset(debounce)
+		}
+	}
+}
+
+func (r *taskRunner) execute(t *task) {
+	if r.onRun != nil {
+		r.onRun(t.rule)
+		return
+	}
+	t.execute()
+}
+
+func (t *task) execute() {
+	t.run.Lock()
+	defer t.run.Unlock()
+
+	log.Printf("Running %s for %s\n", strings.Join(t.rule.Command, " "), t.rule.Pattern)
+	cmd := exec.Command(t.rule.Command[0], t.rule.Command[1:]...)
+	cmd.Stdout = childStdout()
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("Error running %s: %v\n", strings.Join(t.rule.Command, " "), err)
+	}
+}
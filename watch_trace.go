@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Set by --verbose: log every event and what was decided about it.
+var verbose bool
+
+// tracef logs at verbose level only.
+func tracef(format string, args ...any) {
+	if verbose {
+		log.Printf("trace: "+format, args...)
+	}
+}
+
+// traceEvent explains why a received event in a root does or doesn't
+// regenerate the trees.
+func traceEvent(event fsnotify.Event, root string, structural bool) {
+	if !verbose {
+		return
+	}
+	if _, reincluded := ignoreFileRules(event.Name); reincluded != "" {
+		tracef("%s: re-included by %s\n", event.Name, reincluded)
+	}
+	var reason string
+	switch {
+	case event.Has(fsnotify.Create):
+		reason = "created"
+	case event.Has(fsnotify.Remove):
+		reason = "removed"
+	case event.Has(fsnotify.Rename):
+		reason = "renamed"
+	case isIgnoreFile(event.Name) || filepath.Base(event.Name) == ".gitattributes":
+		reason = "ignore rules changed"
+	case root == event.Name:
+		reason = "watched file written"
+	}
+	if structural {
+		tracef("%s: %s; regenerating once events settle\n", event.Name, reason)
+	} else {
+		tracef("%s: %s leaves the tree's structure alone; not regenerating\n", event.Name, event.Op)
+	}
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+// treeNode is one entry of a generated tree. Local roots are built from a
+// filesystem walk, remote roots from a listing fetched by their poller.
+type treeNode struct {
+	Name     string      `json:"name"`
+	IsDir    bool        `json:"dir"`
+	Size     int64       `json:"size"`
+	ModTime  time.Time   `json:"mtime"`
+	Children []*treeNode `json:"children,omitempty"`
+
+	// Marked linguist-generated in .gitattributes.
+	Generated bool `json:"generated,omitempty"`
+
+	// Type and permission bits, for coloring. Zero for remote roots.
+	Mode os.FileMode `json:"-"`
+	// Nil for remote roots and on Windows.
+	Owner *fileOwner `json:"-"`
+
+	// Sniffed content type, when MIME rules are configured, and whether a
+	// rule asks for the file to be summarized rather than listed.
+	MimeType   string `json:"-"`
+	Summarized bool   `json:"-"`
+
+	// What the node cap removed from this directory.
+	Pruned *watchapi.Pruned `json:"pruned,omitempty"`
+
+	// Roots an entry of a union comes from, bottom layer first.
+	Origins []string `json:"origins,omitempty"`
+
+	// Description from the config's notes.
+	Note string `json:"note,omitempty"`
+
+	// Labels from the config's tags, sorted.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// buildTree returns the tree for a configured root, local or remote.
+func buildTree(ctx context.Context, rootDir string) (*treeNode, error) {
+	if isRemoteRoot(rootDir) {
+		return remoteTree(rootDir)
+	}
+	return buildLocalTree(ctx, rootDir)
+}
+
+// buildLocalTree walks rootDir, skipping ignored entries. It stops with
+// ctx's error once ctx is canceled.
+func buildLocalTree(ctx context.Context, rootDir string) (*treeNode, error) {
+	info, err := fsys.Stat(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return &treeNode{Name: rootDir, Size: info.Size(), ModTime: info.ModTime()}, nil
+	}
+
+	root := &treeNode{Name: rootDir, IsDir: true, ModTime: info.ModTime()}
+	nodes := map[string]*treeNode{rootDir: root}
+	var attrs *gitAttributes
+	generated := currentGeneratedMode()
+	if generated != "show" {
+		attrs = newGitAttributes(rootDir)
+	}
+	guard := newMemoryGuard(rootDir)
+	defer guard.report()
+
+	err = walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path == rootDir {
+			return nil
+		}
+		if isIgnored(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		node := &treeNode{Name: info.Name(), IsDir: info.IsDir(), Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode(), Owner: ownerOf(info)}
+		if info.Mode().IsRegular() {
+			action, mime := mimeAction(path, info.Size(), info.ModTime())
+			if action == "exclude" {
+				return nil
+			}
+			node.MimeType, node.Summarized = mime, action == "summarize"
+		}
+		if attrs != nil && attrs.generated(path, info.IsDir()) {
+			if generated != "mark" {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			node.Generated = true
+		}
+		if parent := nodes[filepath.Dir(path)]; parent != nil {
+			parent.Children = append(parent.Children, node)
+		}
+		if info.IsDir() {
+			nodes[path] = node
+		}
+		if guard.skip(path, info.IsDir()) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// insertPath adds node under root at the slash-separated relative path,
+// creating any missing intermediate directories.
+func insertPath(root *treeNode, relPath string, node *treeNode) {
+	parts := strings.Split(relPath, "/")
+	parent := root
+	for _, part := range parts[:len(parts)-1] {
+		var next *treeNode
+		for _, child := range parent.Children {
+			if child.Name == part {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			next = &treeNode{Name: part, IsDir: true}
+			parent.Children = append(parent.Children, next)
+		}
+		parent = next
+	}
+	node.Name = parts[len(parts)-1]
+	for _, child := range parent.Children {
+		if child.Name == node.Name {
+			// An intermediate directory was created before its own entry.
+			child.IsDir, child.Size, child.ModTime = node.IsDir, node.Size, node.ModTime
+			return
+		}
+	}
+	parent.Children = append(parent.Children, node)
+}
+
+// sortTree orders every directory's children by name, matching the order
+// of a local walk.
+func sortTree(node *treeNode) {
+	sort.Slice(node.Children, func(i, j int) bool { return node.Children[i].Name < node.Children[j].Name })
+	for _, child := range node.Children {
+		sortTree(child)
+	}
+}
+
+// cloneTree copies node and everything beneath it, so the copy can be
+// annotated or pruned without touching the original.
+func cloneTree(node *treeNode) *treeNode {
+	c := *node
+	c.Children = nil
+	if node.Children != nil {
+		c.Children = make([]*treeNode, len(node.Children))
+		for i, child := range node.Children {
+			c.Children[i] = cloneTree(child)
+		}
+	}
+	return &c
+}
+
+// RenderConfig holds options for the text rendering; Paths also applies
+// to the jsonl, csv and tsv outputs. The JSON output is not affected.
+type RenderConfig struct {
+	// "mark" renders empty directories as "name/ (empty)", "hide" leaves
+	// them out, along with directories containing only empty ones.
+	EmptyDirs string `json:"emptyDirs,omitempty"`
+
+	// Render chains of directories that each contain a single directory
+	// on one line, e.g. "app/(admin)/products".
+	CollapseChains bool `json:"collapseChains,omitempty"`
+
+	// Fold directories deeper than this into a single
+	// "… (37 files in 9 dirs)" line. Zero shows every level.
+	MaxDepth int `json:"maxDepth,omitempty"`
+
+	// Show image dimensions, video durations and sizes after asset names,
+	// and summarize a directory's assets on one line once it holds more
+	// than AssetGroupThreshold of them.
+	Assets              bool `json:"assets,omitempty"`
+	AssetGroupThreshold int  `json:"assetGroupThreshold,omitempty"`
+
+	// Show at most this many entries of a directory, followed by
+	// "… and 4,812 more files". Zero shows them all.
+	MaxEntriesPerDir int `json:"maxEntriesPerDir,omitempty"`
+
+	// Templates for what surrounds each root in the combined output.
+	Sections SectionConfig `json:"sections,omitzero"`
+
+	// Connector characters: "unicode" (default, "├── "), "ascii" ("|-- ",
+	// "`-- ") or "custom", which uses Glyphs. Custom trees can't be read
+	// back by `watch diff`.
+	Style  string       `json:"style,omitempty"`
+	Glyphs *GlyphConfig `json:"glyphs,omitempty"`
+
+	// Color entries printed to a terminal: "auto" (default) when stdout
+	// is a TTY and NO_COLOR is unset, "always" or "never". Files are
+	// never colored.
+	Color string `json:"color,omitempty"`
+
+	// Shorten entries so lines are at most this many columns wide, by
+	// replacing the middle of the name with an ellipsis, then the end of
+	// its note. Zero disables.
+	MaxLineWidth int `json:"maxLineWidth,omitempty"`
+
+	// Show an icon before each entry: "emoji" or "nerd" (Nerd Font).
+	// IconMap adds or replaces icons by lowercase file name, extension
+	// (".ts") or the fallbacks "dir" and "file".
+	Icons   string            `json:"icons,omitempty"`
+	IconMap map[string]string `json:"iconMap,omitempty"`
+
+	// Show each entry's permission bits and "user:group" owner in
+	// brackets, e.g. "[-rw-r--r-- www-data:www-data]".
+	Permissions bool `json:"permissions,omitempty"`
+	Owner       bool `json:"owner,omitempty"`
+
+	// How entries are named: "name" (default) shows base names,
+	// "relative" paths relative to the watched root, "absolute" absolute
+	// paths. Flat outputs default to paths starting with the root.
+	Paths string `json:"paths,omitempty"`
+
+	// Prefix entries added since the previous generation with "+" and
+	// list removed ones below the tree.
+	ChangeMarkers bool `json:"changeMarkers,omitempty"`
+
+	// Set for the rendering sent to the console when colors are on.
+	color bool
+	// Root being rendered, for relative paths.
+	rootDir string
+	// Changes of the root being rendered, with ChangeMarkers.
+	changes *treeChanges
+}
+
+// displayPath renders path, beneath rootDir, as the Paths mode asks. ok is
+// false in the default mode, where entries show their base name.
+func (opts RenderConfig) displayPath(rootDir, path string) (string, bool) {
+	switch opts.Paths {
+	case "relative":
+		if rel, err := filepath.Rel(rootDir, path); err == nil {
+			return filepath.ToSlash(rel), true
+		}
+	case "absolute":
+		if abs, err := filepath.Abs(path); err == nil {
+			return filepath.ToSlash(abs), true
+		}
+	}
+	return "", false
+}
+
+// GlyphConfig holds the prefix strings of the "custom" style. Each level
+// of nesting adds Indent; entries start with Branch, the last one in a
+// directory with Last.
+type GlyphConfig struct {
+	Indent string `json:"indent"`
+	Branch string `json:"branch"`
+	Last   string `json:"last"`
+}
+
+type treeGlyphs struct {
+	indent, branch, last, ellipsis string
+}
+
+var (
+	unicodeGlyphs = treeGlyphs{indent: "│   ", branch: "├── ", last: "└── ", ellipsis: "…"}
+	asciiGlyphs   = treeGlyphs{indent: "|   ", branch: "|-- ", last: "`-- ", ellipsis: "..."}
+)
+
+func (opts RenderConfig) glyphs() treeGlyphs {
+	if plainOutput {
+		return asciiGlyphs
+	}
+	switch opts.Style {
+	case "ascii":
+		return asciiGlyphs
+	case "custom":
+		if g := opts.Glyphs; g != nil {
+			return treeGlyphs{indent: g.Indent, branch: g.Branch, last: g.Last, ellipsis: "…"}
+		}
+	}
+	return unicodeGlyphs
+}
+
+// renderTree draws root in the box-drawing text format. File roots get a
+// single header line with their metadata. The git state, if any, follows
+// the header in brackets.
+func renderTree(root generatedRoot, opts RenderConfig) string {
+	var builder strings.Builder
+	if !root.Tree.IsDir {
+		builder.WriteString(fmt.Sprintf("File: %s (%s, modified %s)%s\n",
+			redactText(root.title()), formatSize(root.Tree.Size), formatTime(root.Tree.ModTime), gitHeaderSuffix(root.Git)))
+		return builder.String()
+	}
+	builder.WriteString(fmt.Sprintf("Directory: %s%s\n", redactText(root.title()), gitHeaderSuffix(root.Git)))
+	opts.rootDir = root.Dir
+	renderChildren(&builder, root.Tree, root.Dir, 1, opts)
+	builder.WriteString(removedSection(opts.changes))
+	return builder.String()
+}
+
+func renderChildren(builder *strings.Builder, node *treeNode, dir string, depth int, opts RenderConfig) {
+	glyphs := opts.glyphs()
+	indent := strings.Repeat(glyphs.indent, depth-1)
+	children := visibleChildren(node, opts)
+	if node.Pruned != nil && len(children) == 0 {
+		builder.WriteString(fmt.Sprintf("%s%s%s\n", indent, glyphs.last, prunedLabel(node.Pruned, glyphs.ellipsis)))
+		return
+	}
+	if opts.MaxDepth > 0 && depth > opts.MaxDepth && len(children) > 0 {
+		files, dirs := countTree(node, opts)
+		builder.WriteString(fmt.Sprintf("%s%s%s (%s in %s)\n", indent, glyphs.last, glyphs.ellipsis, plural(files, "file"), plural(dirs, "dir")))
+		return
+	}
+
+	// Past the threshold, a directory's assets are summarized on one
+	// line after its other entries.
+	var groupLabel string
+	if opts.Assets && opts.AssetGroupThreshold > 0 {
+		var others, assets []*treeNode
+		for _, child := range children {
+			if !child.IsDir && assetKind(child.Name) != "" {
+				assets = append(assets, child)
+			} else {
+				others = append(others, child)
+			}
+		}
+		if len(assets) > opts.AssetGroupThreshold {
+			children = others
+			groupLabel = assetGroupLabel(assets)
+		}
+	}
+
+	// Files a MIME rule summarizes are counted on one line per rule.
+	var mimeLabels []string
+	if len(currentMimeRules()) > 0 {
+		var listed, summarized []*treeNode
+		for _, child := range children {
+			if child.Summarized {
+				summarized = append(summarized, child)
+			} else {
+				listed = append(listed, child)
+			}
+		}
+		if len(summarized) > 0 {
+			children = listed
+			mimeLabels = mimeGroupLabels(summarized)
+		}
+	}
+
+	var moreLabel string
+	if opts.MaxEntriesPerDir > 0 && len(children) > opts.MaxEntriesPerDir {
+		moreLabel = glyphs.ellipsis + " and " + moreEntries(children[opts.MaxEntriesPerDir:])
+		children = children[:opts.MaxEntriesPerDir]
+	}
+
+	for i, child := range children {
+		prefix := glyphs.branch
+		if i == len(children)-1 && groupLabel == "" && moreLabel == "" && len(mimeLabels) == 0 {
+			prefix = glyphs.last
+		}
+		path := filepath.Join(dir, child.Name)
+		name := child.Name
+		if opts.CollapseChains {
+			for child.IsDir {
+				only := visibleChildren(child, opts)
+				if len(only) != 1 || !only[0].IsDir {
+					break
+				}
+				child = only[0]
+				name += "/" + child.Name
+				path = filepath.Join(path, child.Name)
+			}
+		}
+		if display, ok := opts.displayPath(opts.rootDir, path); ok {
+			name = display
+		}
+		name = redactText(name)
+		var suffix string
+		if opts.EmptyDirs == "mark" && child.IsDir && len(child.Children) == 0 {
+			suffix += "/ (empty)"
+		}
+		if opts.Assets && !child.IsDir && assetKind(child.Name) != "" {
+			suffix += " (" + assetLabel(path, child) + ")"
+		}
+		if child.Generated {
+			suffix += " (generated)"
+		}
+		if meta := opts.entryMetadata(child); meta != "" {
+			suffix += " [" + meta + "]"
+		}
+		if len(child.Origins) > 0 {
+			suffix += " (from " + strings.Join(redactAll(child.Origins), ", ") + ")"
+		}
+		suffix += tagsLabel(child.Tags)
+		var note string
+		if child.Note != "" {
+			note = noteSuffix + redactText(child.Note)
+		}
+		icon := opts.icon(child)
+		if icon != "" {
+			icon += " "
+		}
+		marker := opts.addedMarker(path)
+		if opts.MaxLineWidth > 0 {
+			used := runewidth.StringWidth(indent + prefix + marker + icon)
+			name, note = fitLine(opts.MaxLineWidth-used, name, suffix, note, glyphs.ellipsis)
+		}
+		name += suffix
+		if opts.color {
+			name = colorize(child, name)
+		}
+		name = marker + icon + name + note
+		builder.WriteString(fmt.Sprintf("%s%s%s\n", indent, prefix, name))
+		if child.IsDir {
+			renderChildren(builder, child, path, depth+1, opts)
+		}
+	}
+	if moreLabel != "" {
+		prefix := glyphs.last
+		if groupLabel != "" || len(mimeLabels) > 0 {
+			prefix = glyphs.branch
+		}
+		builder.WriteString(fmt.Sprintf("%s%s%s\n", indent, prefix, moreLabel))
+	}
+	for i, label := range mimeLabels {
+		prefix := glyphs.last
+		if groupLabel != "" || i < len(mimeLabels)-1 {
+			prefix = glyphs.branch
+		}
+		builder.WriteString(fmt.Sprintf("%s%s%s\n", indent, prefix, label))
+	}
+	if groupLabel != "" {
+		builder.WriteString(fmt.Sprintf("%s%s%s\n", indent, glyphs.last, groupLabel))
+	}
+}
+
+// moreEntries describes the entries left out of a directory, e.g.
+// "4,812 more files and 3 more dirs".
+func moreEntries(hidden []*treeNode) string {
+	var files, dirs int
+	for _, node := range hidden {
+		if node.IsDir {
+			dirs++
+		} else {
+			files++
+		}
+	}
+	var parts []string
+	if files > 0 {
+		parts = append(parts, groupThousands(files)+" more "+pluralNoun(files, "file"))
+	}
+	if dirs > 0 {
+		parts = append(parts, groupThousands(dirs)+" more "+pluralNoun(dirs, "dir"))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// groupThousands formats n with comma separators, e.g. "4,812".
+func groupThousands(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// visibleChildren returns the children of node that the text rendering
+// shows.
+func visibleChildren(node *treeNode, opts RenderConfig) []*treeNode {
+	if opts.EmptyDirs != "hide" {
+		return node.Children
+	}
+	var children []*treeNode
+	for _, child := range node.Children {
+		if !child.IsDir || len(visibleChildren(child, opts)) > 0 {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// countTree counts the files and directories shown beneath node.
+func countTree(node *treeNode, opts RenderConfig) (files, dirs int) {
+	for _, child := range visibleChildren(node, opts) {
+		if !child.IsDir {
+			files++
+			continue
+		}
+		f, d := countTree(child, opts)
+		files, dirs = files+f, dirs+d+1
+	}
+	return files, dirs
+}
+
+// Columns of a name kept before a note is shortened to fit maxLineWidth.
+const minNameWidth = 12
+
+// fitLine shortens an entry's name and note so that together with the
+// suffix they fit in width columns. The suffix is kept whole as the
+// metadata in it is read back from snapshots. The name loses its middle
+// first, down to minNameWidth columns, then the note its end.
+func fitLine(width int, name, suffix, note, ellipsis string) (string, string) {
+	room := width - runewidth.StringWidth(suffix)
+	if note != "" && room-runewidth.StringWidth(note) < min(runewidth.StringWidth(name), minNameWidth) {
+		keep := room - min(runewidth.StringWidth(name), minNameWidth)
+		if keep > runewidth.StringWidth(noteSuffix+ellipsis) {
+			note = runewidth.Truncate(note, keep, ellipsis)
+		} else {
+			note = ""
+		}
+	}
+	return truncateMiddle(name, room-runewidth.StringWidth(note), ellipsis), note
+}
+
+// truncateMiddle shortens s to width columns by replacing its middle with
+// ellipsis, keeping the start and the end, where the extension or a
+// hash usually is.
+func truncateMiddle(s string, width int, ellipsis string) string {
+	if runewidth.StringWidth(s) <= width {
+		return s
+	}
+	room := width - runewidth.StringWidth(ellipsis)
+	if room < 2 {
+		return runewidth.Truncate(s, max(width, 1), "")
+	}
+	runes := []rune(s)
+	headWidth, tailWidth := (room+1)/2, room/2
+	var head, tail []rune
+	for _, r := range runes {
+		if w := runewidth.RuneWidth(r); runewidth.StringWidth(string(head))+w <= headWidth {
+			head = append(head, r)
+			continue
+		}
+		break
+	}
+	for i := len(runes) - 1; i >= len(head); i-- {
+		if w := runewidth.RuneWidth(runes[i]); runewidth.StringWidth(string(tail))+w <= tailWidth {
+			tail = append([]rune{runes[i]}, tail...)
+			continue
+		}
+		break
+	}
+	return string(head) + ellipsis + string(tail)
+}
+
+func plural(n int, noun string) string {
+	return fmt.Sprintf("%d %s", n, pluralNoun(n, noun))
+}
+
+func pluralNoun(n int, noun string) string {
+	if n == 1 {
+		return noun
+	}
+	return noun + "s"
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-runewidth"
+)
+
+func TestMaxLineWidthCountsDecorations(t *testing.T) {
+	tree := &treeNode{Name: "src", IsDir: true, Children: []*treeNode{
+		{Name: "a-very-long-component-name.generated.tsx", Generated: true, Tags: []string{"ui"}, Note: "the storefront's product card and its variants"},
+		{Name: "index.ts", Note: "entry"},
+	}}
+	opts := RenderConfig{MaxLineWidth: 50}
+	out := renderTree(generatedRoot{Dir: "src", Tree: tree}, opts)
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if w := runewidth.StringWidth(line); w > opts.MaxLineWidth {
+			t.Errorf("line %q is %d columns wide, want at most %d", line, w, opts.MaxLineWidth)
+		}
+	}
+	if !strings.Contains(out, " (generated) [ui]") {
+		t.Errorf("decorations were shortened:\n%s", out)
+	}
+	if !strings.Contains(out, "index.ts  # entry") {
+		t.Errorf("short entry was changed:\n%s", out)
+	}
+}
+
+func TestFitLine(t *testing.T) {
+	tests := []struct {
+		width              int
+		name, note         string
+		wantName, wantNote string
+	}{
+		{40, "main.go", "  # entry", "main.go", "  # entry"},
+		{12, "component-name.tsx", "", "compo....tsx", ""},
+		{30, "component-name.tsx", "  # a long description", "compo....tsx", "  # a long desc..."},
+		{16, "component-name.tsx", "  # a long description", "compone...me.tsx", ""},
+	}
+	for _, tt := range tests {
+		name, note := fitLine(tt.width, tt.name, "", tt.note, "...")
+		if name != tt.wantName || note != tt.wantNote {
+			t.Errorf("fitLine(%d, %q, %q) = %q, %q, want %q, %q", tt.width, tt.name, tt.note, name, note, tt.wantName, tt.wantNote)
+		}
+	}
+}
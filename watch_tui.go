@@ -0,0 +1,280 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+// Number of recent events kept in the bottom pane.
+const tuiEventCount = 8
+
+const (
+	ansiReverse = "\x1b[7m"
+	ansiDim     = "\x1b[2m"
+	ansiBold    = "\x1b[1m"
+	ansiReset   = "\x1b[0m"
+)
+
+// tuiNode is a lazily loaded entry in the live tree view. Children are read
+// from disk the first time a directory is expanded and on every refresh.
+type tuiNode struct {
+	name     string
+	path     string
+	isDir    bool
+	ignored  bool
+	expanded bool
+	children []*tuiNode
+}
+
+type tuiLine struct {
+	node  *tuiNode
+	depth int
+}
+
+// tuiRefreshMsg asks the view to re-read the tree after a filesystem event.
+type tuiRefreshMsg struct{}
+type tuiLogMsg string
+type tuiRegeneratedMsg struct{}
+
+type tuiModel struct {
+	roots       []*tuiNode
+	lines       []tuiLine
+	cursor      int
+	offset      int
+	width       int
+	height      int
+	showIgnored bool
+	events      []string
+	regenerate  func()
+}
+
+// newTUI builds the interactive view for directories. regenerate is invoked
+// in the background when the user forces a regeneration.
+func newTUI(directories []string, regenerate func()) *tea.Program {
+	m := &tuiModel{regenerate: regenerate}
+	for _, dir := range directories {
+		root := &tuiNode{name: dir, path: dir, isDir: !isFileRoot(dir), expanded: true}
+		m.roots = append(m.roots, root)
+	}
+	m.refresh()
+	return tea.NewProgram(m, tea.WithAltScreen())
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tuiRefreshMsg:
+		m.refresh()
+	case tuiLogMsg:
+		m.addEvent(string(msg))
+	case tuiRegeneratedMsg:
+		m.addEvent("Regeneration finished")
+		m.refresh()
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.lines)-1 {
+				m.cursor++
+			}
+		case "enter", " ", "right", "l", "left", "h":
+			if m.cursor < len(m.lines) {
+				node := m.lines[m.cursor].node
+				if node.isDir {
+					node.expanded = !node.expanded
+					m.refresh()
+				}
+			}
+		case "i":
+			m.showIgnored = !m.showIgnored
+			m.refresh()
+		case "r":
+			m.addEvent("Forced regeneration requested")
+			return m, func() tea.Msg {
+				m.regenerate()
+				return tuiRegeneratedMsg{}
+			}
+		}
+	}
+	m.scroll()
+	return m, nil
+}
+
+func (m *tuiModel) View() string {
+	var b strings.Builder
+	b.WriteString(ansiBold + "Watching: " + m.rootNames() + ansiReset + "\n")
+	b.WriteString(ansiDim + "↑/↓ move  enter expand/collapse  i toggle ignored  r regenerate  q quit" + ansiReset + "\n\n")
+
+	treeHeight := m.treeHeight()
+	for i := m.offset; i < len(m.lines) && i < m.offset+treeHeight; i++ {
+		line := m.lines[i]
+		text := strings.Repeat("  ", line.depth) + m.label(line.node)
+		if m.width > 0 {
+			text = runewidth.Truncate(text, m.width, "")
+		}
+		switch {
+		case i == m.cursor:
+			text = ansiReverse + text + ansiReset
+		case line.node.ignored:
+			text = ansiDim + text + ansiReset
+		}
+		b.WriteString(text + "\n")
+	}
+	for i := len(m.lines) - m.offset; i < treeHeight; i++ {
+		b.WriteString("\n")
+	}
+
+	b.WriteString(ansiBold + "Recent events" + ansiReset + "\n")
+	for _, e := range m.events {
+		b.WriteString(e + "\n")
+	}
+	return b.String()
+}
+
+func (m *tuiModel) rootNames() string {
+	names := make([]string, len(m.roots))
+	for i, root := range m.roots {
+		names[i] = root.name
+	}
+	return strings.Join(names, ", ")
+}
+
+func (m *tuiModel) label(node *tuiNode) string {
+	if !node.isDir {
+		return "  " + node.name
+	}
+	if node.expanded {
+		return "▾ " + node.name + "/"
+	}
+	return "▸ " + node.name + "/"
+}
+
+// treeHeight is the number of rows available for the tree pane.
+func (m *tuiModel) treeHeight() int {
+	h := m.height - tuiEventCount - 4
+	if h < 1 {
+		return 1
+	}
+	return h
+}
+
+// scroll keeps the cursor inside the visible window.
+func (m *tuiModel) scroll() {
+	if m.cursor >= len(m.lines) {
+		m.cursor = len(m.lines) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if h := m.treeHeight(); m.cursor >= m.offset+h {
+		m.offset = m.cursor - h + 1
+	}
+}
+
+func (m *tuiModel) addEvent(text string) {
+	m.events = append(m.events, time.Now().Format("15:04:05")+" "+text)
+	if len(m.events) > tuiEventCount {
+		m.events = m.events[len(m.events)-tuiEventCount:]
+	}
+}
+
+// refresh re-reads every expanded directory and rebuilds the visible lines.
+func (m *tuiModel) refresh() {
+	m.lines = m.lines[:0]
+	for _, root := range m.roots {
+		m.appendLines(root, 0)
+	}
+	m.scroll()
+}
+
+func (m *tuiModel) appendLines(node *tuiNode, depth int) {
+	m.lines = append(m.lines, tuiLine{node: node, depth: depth})
+	if !node.isDir || !node.expanded {
+		return
+	}
+	m.load(node)
+	for _, child := range node.children {
+		m.appendLines(child, depth+1)
+	}
+}
+
+// load reads the children of node, preserving the expanded state of
+// directories that were already known.
+func (m *tuiModel) load(node *tuiNode) {
+	entries, err := fsys.ReadDir(node.path)
+	if err != nil {
+		node.children = nil
+		return
+	}
+	previous := make(map[string]*tuiNode, len(node.children))
+	for _, child := range node.children {
+		previous[child.name] = child
+	}
+
+	children := make([]*tuiNode, 0, len(entries))
+	for _, entry := range entries {
+		path := filepath.Join(node.path, entry.Name())
+		ignored := isIgnored(path)
+		if ignored && !m.showIgnored {
+			continue
+		}
+		child := previous[entry.Name()]
+		if child == nil {
+			child = &tuiNode{name: entry.Name(), path: path}
+		}
+		child.isDir = entry.IsDir()
+		child.ignored = ignored
+		children = append(children, child)
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		if children[i].isDir != children[j].isDir {
+			return children[i].isDir
+		}
+		return children[i].name < children[j].name
+	})
+	node.children = children
+}
+
+// tuiLogWriter forwards log output to the TUI's event pane in order,
+// without blocking callers while the program is starting up.
+type tuiLogWriter struct {
+	lines chan string
+}
+
+func newTUILogWriter(p *tea.Program) *tuiLogWriter {
+	w := &tuiLogWriter{lines: make(chan string, 256)}
+	go func() {
+		for line := range w.lines {
+			p.Send(tuiLogMsg(line))
+		}
+	}()
+	return w
+}
+
+func (w *tuiLogWriter) Write(b []byte) (int, error) {
+	line := strings.TrimRight(string(b), "\n")
+	select {
+	case w.lines <- line:
+	default:
+		// Drop log lines rather than stall the watcher when the UI lags.
+	}
+	return len(b), nil
+}
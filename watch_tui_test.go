@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+func TestTUICutsLinesByColumns(t *testing.T) {
+	m := &tuiModel{width: 12, height: 20}
+	root := &tuiNode{name: "shop", path: "shop", isDir: true, expanded: true, children: []*tuiNode{
+		{name: "店舗の商品一覧.ts", path: "shop/店舗の商品一覧.ts"},
+	}}
+	m.roots = []*tuiNode{root}
+	m.lines = []tuiLine{{node: root}, {node: root.children[0], depth: 1}}
+	m.cursor = -1
+
+	for _, line := range strings.Split(m.View(), "\n") {
+		if !strings.Contains(line, "店") {
+			continue
+		}
+		if !utf8.ValidString(line) || !strings.HasSuffix(line, "店舗の商") {
+			t.Errorf("line %q doesn't end with the whole runes that fit", line)
+		}
+		if w := runewidth.StringWidth(line); w > m.width {
+			t.Errorf("line %q is %d columns wide, want at most %d", line, w, m.width)
+		}
+		return
+	}
+	t.Error("no line for the file")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// UnionConfig overlays several watched roots into one tree, such as a
+// build directory over its sources, to show the effective structure.
+// Later roots are laid over earlier ones: where both have a file, the
+// later one's is shown.
+type UnionConfig struct {
+	Name  string   `json:"name"`  // Shown in place of a directory
+	Roots []string `json:"roots"` // Configured directories, bottom layer first
+}
+
+// unionRoots builds the configured unions from the generated roots.
+// Every entry records the roots it came from.
+func unionRoots(unions []UnionConfig, roots []generatedRoot) []generatedRoot {
+	var result []generatedRoot
+	for _, u := range unions {
+		merged := &treeNode{Name: u.Name, IsDir: true}
+		for _, dir := range u.Roots {
+			i := slices.IndexFunc(roots, func(r generatedRoot) bool { return r.Dir == dir })
+			if i < 0 {
+				log.Printf("Union %s: %s is not a generated directory\n", u.Name, dir)
+				continue
+			}
+			if !roots[i].Tree.IsDir {
+				log.Printf("Union %s: %s is a file, not a directory\n", u.Name, dir)
+				continue
+			}
+			overlay(merged, roots[i].Tree, dir)
+		}
+		result = append(result, generatedRoot{Dir: u.Name, Tree: merged, Union: u.Roots})
+	}
+	return result
+}
+
+// overlay copies src's children into dst, marking each with origin.
+func overlay(dst, src *treeNode, origin string) {
+	if src.ModTime.After(dst.ModTime) {
+		dst.ModTime = src.ModTime
+	}
+	for _, child := range src.Children {
+		i := slices.IndexFunc(dst.Children, func(n *treeNode) bool { return n.Name == child.Name })
+		if i < 0 {
+			dst.Children = append(dst.Children, copyWithOrigin(child, origin))
+			continue
+		}
+		existing := dst.Children[i]
+		if existing.IsDir && child.IsDir {
+			existing.Origins = append(existing.Origins, origin)
+			overlay(existing, child, origin)
+			continue
+		}
+		replacement := copyWithOrigin(child, origin)
+		replacement.Origins = append(existing.Origins, origin)
+		dst.Children[i] = replacement
+	}
+	slices.SortFunc(dst.Children, func(a, b *treeNode) int { return strings.Compare(a.Name, b.Name) })
+}
+
+// copyWithOrigin copies node and everything beneath it, leaving the
+// generated trees untouched.
+func copyWithOrigin(node *treeNode, origin string) *treeNode {
+	c := *node
+	c.Origins = []string{origin}
+	c.Children = nil
+	for _, child := range node.Children {
+		c.Children = append(c.Children, copyWithOrigin(child, origin))
+	}
+	return &c
+}
+
+// renderUnion renders a union root, with the roots each entry comes from.
+func renderUnion(root generatedRoot, opts RenderConfig) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Union: %s (%s)\n", redactText(root.Dir), strings.Join(redactAll(root.Union), " + ")))
+	opts.rootDir = root.Dir
+	renderChildren(&builder, root.Tree, root.Dir, 1, opts)
+	return builder.String()
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitHub repository whose releases carry the prebuilt binaries. Releases
+// must attach one asset per platform named watch_<goos>_<goarch>[.exe], a
+// checksums.txt in sha256sum format and its ed25519 signature,
+// checksums.txt.sig; .github/workflows/watch-release.yml publishes them.
+var updateRepo = "Tobiscuit/three-chicks-and-a-wick-admin"
+
+// Base64 ed25519 public key used to verify checksums.txt.sig. Set via
+// -ldflags "-X main.updatePublicKey=..."; builds without one refuse to
+// update themselves, as the checksums alone come from the same release as
+// the binary.
+var updatePublicKey = ""
+
+const checksumsAssetName = "checksums.txt"
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r githubRelease) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// runSelfUpdate implements `watch self-update`.
+func runSelfUpdate(args []string) {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	checkOnly := fs.Bool("check", false, "Only report whether a newer release exists")
+	force := fs.Bool("force", false, "Install the latest release even if it is not newer")
+	fs.Parse(args)
+
+	current := currentBuildInfo().Version
+	release, err := fetchLatestRelease()
+	if err != nil {
+		log.Fatalf("Error checking for updates: %v", err)
+	}
+
+	newer := compareVersions(release.TagName, current) > 0
+	if !newer && !*force {
+		fmt.Printf("watch %s is up to date (latest release %s)\n", current, release.TagName)
+		return
+	}
+	if *checkOnly {
+		fmt.Printf("A newer release is available: %s (current %s)\n", release.TagName, current)
+		return
+	}
+
+	assetName := fmt.Sprintf("watch_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		assetName += ".exe"
+	}
+	binaryURL := release.assetURL(assetName)
+	checksumsURL := release.assetURL(checksumsAssetName)
+	if binaryURL == "" || checksumsURL == "" {
+		log.Fatalf("Release %s has no %s or %s asset", release.TagName, assetName, checksumsAssetName)
+	}
+
+	if updatePublicKey == "" {
+		log.Fatalf("This build has no update signing key, so %s can't be verified; download it from the release page instead", release.TagName)
+	}
+	sigURL := release.assetURL(checksumsAssetName + ".sig")
+	if sigURL == "" {
+		log.Fatalf("Release %s is not signed", release.TagName)
+	}
+
+	checksums, err := download(checksumsURL)
+	if err != nil {
+		log.Fatalf("Error downloading %s: %v", checksumsAssetName, err)
+	}
+	sig, err := download(sigURL)
+	if err != nil {
+		log.Fatalf("Error downloading signature: %v", err)
+	}
+	if err := verifySignature(checksums, sig); err != nil {
+		log.Fatalf("Signature verification failed: %v", err)
+	}
+
+	binary, err := download(binaryURL)
+	if err != nil {
+		log.Fatalf("Error downloading %s: %v", assetName, err)
+	}
+	if err := verifyChecksum(checksums, assetName, binary); err != nil {
+		log.Fatalf("Checksum verification failed: %v", err)
+	}
+
+	if err := replaceExecutable(binary); err != nil {
+		log.Fatalf("Error installing update: %v", err)
+	}
+	fmt.Printf("Updated watch %s -> %s\n", current, release.TagName)
+}
+
+func fetchLatestRelease() (githubRelease, error) {
+	var release githubRelease
+	data, err := download("https://api.github.com/repos/" + updateRepo + "/releases/latest")
+	if err != nil {
+		return release, err
+	}
+	err = json.Unmarshal(data, &release)
+	return release, err
+}
+
+func download(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifyChecksum checks data against the entry for name in a sha256sum
+// formatted checksums file.
+func verifyChecksum(checksums []byte, name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	got := hex.EncodeToString(sum[:])
+
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			if !strings.EqualFold(fields[0], got) {
+				return fmt.Errorf("%s: expected %s, got %s", name, fields[0], got)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no checksum listed for %s", name)
+}
+
+func verifySignature(message, sig []byte) error {
+	key, err := base64.StdEncoding.DecodeString(updatePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid embedded public key")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err == nil {
+		sig = decoded
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), message, sig) {
+		return fmt.Errorf("signature does not match %s", checksumsAssetName)
+	}
+	return nil
+}
+
+// replaceExecutable swaps the running binary for data. The old binary is
+// moved aside first because Windows refuses to overwrite a running file.
+func replaceExecutable(data []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+	return replaceBinary(exe, data)
+}
+
+// replaceBinary swaps the file at exe for data, keeping its permissions.
+func replaceBinary(exe string, data []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+
+	tmp := exe + ".new"
+	if err := os.WriteFile(tmp, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	// WriteFile's mode is masked by the umask.
+	if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		os.Rename(old, exe)
+		return err
+	}
+	os.Remove(old) // Fails harmlessly on Windows while the old binary is running
+	return nil
+}
+
+// compareVersions compares two vMAJOR.MINOR.PATCH versions, returning 1, 0
+// or -1. Anything that doesn't parse (e.g. "dev") sorts before releases.
+func compareVersions(a, b string) int {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] > pb[i] {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestReplaceBinaryKeepsMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no permission bits")
+	}
+	exe := filepath.Join(t.TempDir(), "watch")
+	if err := os.WriteFile(exe, []byte("old"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(exe, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := replaceBinary(exe, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("mode = %v, want -rwxr-x---", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "new" {
+		t.Errorf("contents = %q, want %q", data, "new")
+	}
+}
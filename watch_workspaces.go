@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// WorkspacesConfig controls how detected workspaces are written.
+type WorkspacesConfig struct {
+	// Written once per workspace; "{workspace}" in a path or URL becomes
+	// the workspace path with slashes replaced by dashes, e.g.
+	// "context-{workspace}.md" → "context-apps-admin.md".
+	Outputs []OutputConfig `json:"outputs,omitempty"`
+
+	// Per-workspace settings keyed by path relative to the root, e.g.
+	// "apps/admin".
+	Rules map[string]WorkspaceRules `json:"rules,omitempty"`
+}
+
+// WorkspaceRules apply to one workspace, in its own outputs and in the
+// combined ones.
+type WorkspaceRules struct {
+	Ignore   []string       `json:"ignore,omitempty"`   // Names or base-name globs left out of the workspace
+	MaxDepth int            `json:"maxDepth,omitempty"` // Overrides render.maxDepth
+	Outputs  []OutputConfig `json:"outputs,omitempty"`  // Replace the shared workspace outputs
+}
+
+// outputsFor returns the outputs of the workspace at rel.
+func (w WorkspacesConfig) outputsFor(rel string) []OutputConfig {
+	if rules, ok := w.Rules[rel]; ok && len(rules.Outputs) > 0 {
+		return rules.Outputs
+	}
+	slug := strings.ReplaceAll(rel, "/", "-")
+	outputs := make([]OutputConfig, len(w.Outputs))
+	for i, o := range w.Outputs {
+		o.Path = strings.ReplaceAll(o.Path, "{workspace}", slug)
+		o.URL = strings.ReplaceAll(o.URL, "{workspace}", slug)
+		outputs[i] = o
+	}
+	return outputs
+}
+
+// allOutputs returns every workspace output, placeholders intact.
+func (w WorkspacesConfig) allOutputs() []OutputConfig {
+	outputs := append([]OutputConfig(nil), w.Outputs...)
+	for _, rules := range w.Rules {
+		outputs = append(outputs, rules.Outputs...)
+	}
+	return outputs
+}
+
+// Workspaces found under each root by --detect-workspaces, as
+// slash-separated paths relative to the root. Each is rendered as its own
+// section and left out of its root's tree.
+var workspaceDirs = make(map[string][]string)
+
+// detectAllWorkspaces fills workspaceDirs for the local directory roots.
+func detectAllWorkspaces(dirs []string) {
+	for _, dir := range dirs {
+		if isRemoteRoot(dir) || isFileRoot(dir) {
+			continue
+		}
+		found := detectWorkspaces(dir)
+		if len(found) == 0 {
+			continue
+		}
+		log.Printf("Detected %d workspaces in %s\n", len(found), dir)
+		workspaceDirs[dir] = found
+	}
+}
+
+// detectWorkspaces returns the package.json and pnpm workspaces, go.work
+// modules and Nx projects under rootDir. Turborepo uses the package
+// manager's workspaces, so those cover it.
+func detectWorkspaces(rootDir string) []string {
+	var patterns []string
+	patterns = append(patterns, packageJSONWorkspaces(rootDir)...)
+	patterns = append(patterns, pnpmWorkspaces(rootDir)...)
+
+	var found []string
+	add := func(rel string) {
+		rel = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(rel)), "./")
+		if rel == "." || rel == "" || strings.HasPrefix(rel, "../") || slices.Contains(found, rel) {
+			return
+		}
+		if info, err := fsys.Stat(filepath.Join(rootDir, rel)); err != nil || !info.IsDir() {
+			return
+		}
+		if isIgnored(filepath.Join(rootDir, rel)) {
+			return
+		}
+		found = append(found, rel)
+	}
+
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+		// "packages/**" is treated like "packages/*".
+		pattern = strings.ReplaceAll(pattern, "**", "*")
+		matches, _ := glob(filepath.Join(rootDir, filepath.FromSlash(pattern)))
+		for _, match := range matches {
+			if _, err := fsys.Stat(filepath.Join(match, "package.json")); err == nil {
+				rel, _ := filepath.Rel(rootDir, match)
+				add(rel)
+			}
+		}
+	}
+	for _, module := range goWorkModules(rootDir) {
+		add(module)
+	}
+
+	// Nx projects are marked by a project.json anywhere in the tree.
+	walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != rootDir && isIgnored(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && info.Name() == "project.json" {
+			rel, _ := filepath.Rel(rootDir, filepath.Dir(path))
+			add(rel)
+		}
+		return nil
+	})
+
+	slices.Sort(found)
+	return found
+}
+
+// packageJSONWorkspaces reads "workspaces" from package.json, either an
+// array or Yarn's {"packages": [...]} form.
+func packageJSONWorkspaces(rootDir string) []string {
+	data, err := fsys.ReadFile(filepath.Join(rootDir, "package.json"))
+	if err != nil {
+		return nil
+	}
+	var pkg struct {
+		Workspaces json.RawMessage `json:"workspaces"`
+	}
+	if json.Unmarshal(data, &pkg) != nil || len(pkg.Workspaces) == 0 {
+		return nil
+	}
+	var list []string
+	if json.Unmarshal(pkg.Workspaces, &list) == nil {
+		return list
+	}
+	var yarn struct {
+		Packages []string `json:"packages"`
+	}
+	json.Unmarshal(pkg.Workspaces, &yarn)
+	return yarn.Packages
+}
+
+// pnpmWorkspaces reads the packages list from pnpm-workspace.yaml. Only the
+// simple "packages:" block of "- pattern" items is understood.
+func pnpmWorkspaces(rootDir string) []string {
+	f, err := fsys.Open(filepath.Join(rootDir, "pnpm-workspace.yaml"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var patterns []string
+	inPackages := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "packages:"):
+			inPackages = true
+		case inPackages && strings.HasPrefix(trimmed, "- "):
+			patterns = append(patterns, strings.Trim(strings.TrimSpace(trimmed[2:]), `'"`))
+		case trimmed != "" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(line, " "):
+			inPackages = false
+		}
+	}
+	return patterns
+}
+
+// goWorkModules reads the use directives from go.work.
+func goWorkModules(rootDir string) []string {
+	data, err := fsys.ReadFile(filepath.Join(rootDir, "go.work"))
+	if err != nil {
+		return nil
+	}
+	var modules []string
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		switch {
+		case line == "use (":
+			inBlock = true
+		case inBlock && line == ")":
+			inBlock = false
+		case inBlock && line != "":
+			modules = append(modules, line)
+		case strings.HasPrefix(line, "use "):
+			modules = append(modules, strings.TrimSpace(strings.TrimPrefix(line, "use ")))
+		}
+	}
+	return modules
+}
+
+// applyWorkspaceRules prunes a workspace's ignored names from its tree and
+// returns its render options.
+func applyWorkspaceRules(config Config, rel string, tree *treeNode) RenderConfig {
+	opts := config.Render
+	rules, ok := config.Workspaces.Rules[rel]
+	if !ok {
+		return opts
+	}
+	if rules.MaxDepth > 0 {
+		opts.MaxDepth = rules.MaxDepth
+	}
+	if len(rules.Ignore) > 0 {
+		pruneNames(tree, rules.Ignore)
+	}
+	return opts
+}
+
+// pruneNames removes the entries whose name equals or matches one of the
+// patterns, at any depth.
+func pruneNames(node *treeNode, patterns []string) {
+	node.Children = slices.DeleteFunc(node.Children, func(c *treeNode) bool {
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, c.Name); matched || c.Name == pattern {
+				return true
+			}
+		}
+		return false
+	})
+	for _, child := range node.Children {
+		pruneNames(child, patterns)
+	}
+}
+
+// removeWorkspaces drops the workspace subtrees from a root's tree.
+func removeWorkspaces(tree *treeNode, workspaces []string) {
+	for _, rel := range workspaces {
+		parts := strings.Split(rel, "/")
+		parent := tree
+		for _, part := range parts[:len(parts)-1] {
+			parent = childNamed(parent, part)
+			if parent == nil {
+				break
+			}
+		}
+		if parent == nil {
+			continue
+		}
+		parent.Children = slices.DeleteFunc(parent.Children, func(c *treeNode) bool {
+			return c.Name == parts[len(parts)-1]
+		})
+	}
+}
+
+func childNamed(node *treeNode, name string) *treeNode {
+	for _, child := range node.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package watchapi_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+
+	"threechicksandawick-admin-panel/watchapi"
+)
+
+func ExampleNewHandler() {
+	checkout := fstest.MapFS{
+		"src/app/page.tsx": {Data: []byte("export default function Page() {}\n")},
+		"src/lib/utils.ts": {Data: []byte("export const noop = () => {}\n")},
+	}
+	var h *watchapi.Handler
+	h = watchapi.NewHandler(func() error {
+		doc, err := watchapi.Generate(checkout, nil, "src")
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		h.Update(data)
+		return nil
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/api/trees", h)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/trees", nil))
+	var doc watchapi.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, dir := range doc.Roots[0].Tree.Children {
+		fmt.Println(dir.Path, dir.Kind, dir.Size)
+	}
+	// Output:
+	// src/app directory 34
+	// src/lib directory 29
+}
@@ -0,0 +1,77 @@
+package watchapi
+
+import (
+	"io/fs"
+	"path"
+	"time"
+)
+
+// Generate builds a document with a root for each of dirs, read from
+// fsys. Entries for which skip reports true are left out with everything
+// beneath them; skip may be nil. Symlinks are listed, not followed.
+//
+// Unlike the watcher, Generate reads no config, ignore files or git
+// attributes: a backend serving its own checkout decides what to show
+// through skip.
+func Generate(fsys fs.FS, skip func(path string, d fs.DirEntry) bool, dirs ...string) (*Document, error) {
+	doc := &Document{
+		Version:     SchemaVersion,
+		Generator:   "watchapi",
+		GeneratedAt: time.Now().UTC(),
+		Roots:       []Root{},
+	}
+	for _, dir := range dirs {
+		info, err := fs.Stat(fsys, dir)
+		if err != nil {
+			return nil, err
+		}
+		tree, err := walkNode(fsys, skip, dir, dir, dir, dir, info)
+		if err != nil {
+			return nil, err
+		}
+		doc.Roots = append(doc.Roots, Root{Directory: dir, Tree: tree})
+	}
+	return doc, nil
+}
+
+// walkNode builds the node for the entry at name in fsys, shown as
+// nodePath under root.
+func walkNode(fsys fs.FS, skip func(string, fs.DirEntry) bool, root, name, base, nodePath string, info fs.FileInfo) (*Node, error) {
+	n := &Node{
+		ID:      NodeID(root, nodePath),
+		Name:    base,
+		Path:    nodePath,
+		Kind:    "file",
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if !info.IsDir() {
+		return n, nil
+	}
+	n.Kind, n.Size = "directory", 0
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		childName := path.Join(name, entry.Name())
+		if skip != nil && skip(childName, entry) {
+			continue
+		}
+		childInfo, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		childPath := entry.Name()
+		if nodePath != "." {
+			childPath = nodePath + "/" + entry.Name()
+		}
+		child, err := walkNode(fsys, skip, root, childName, entry.Name(), childPath, childInfo)
+		if err != nil {
+			return nil, err
+		}
+		n.Size += child.Size
+		n.Children = append(n.Children, child)
+	}
+	return n, nil
+}
@@ -0,0 +1,34 @@
+package watchapi
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGenerate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"README.md":               {Data: []byte("# Admin\n")},
+		"src/index.ts":            {Data: []byte("export {}\n")},
+		"node_modules/x/index.js": {Data: []byte("module.exports = {}\n")},
+	}
+	skip := func(path string, d fs.DirEntry) bool { return d.Name() == "node_modules" }
+	doc, err := Generate(fsys, skip, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := doc.Roots[0].Tree
+	var paths []string
+	for _, child := range tree.Children {
+		paths = append(paths, child.Path)
+	}
+	if len(paths) != 2 || paths[0] != "README.md" || paths[1] != "src" {
+		t.Errorf("root children = %q, want README.md and src", paths)
+	}
+	if tree.Size != 18 {
+		t.Errorf("root size = %d, want 18", tree.Size)
+	}
+	if index := tree.Children[1].Children[0]; index.Path != "src/index.ts" || index.ID != NodeID(".", "src/index.ts") {
+		t.Errorf("src/index.ts node = %+v", index)
+	}
+}
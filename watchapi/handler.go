@@ -0,0 +1,118 @@
+// Package watchapi holds the directory watcher's tree JSON model and serves
+// it over HTTP, so a backend can mount it next to its own routes instead of
+// running the watcher binary and reading its output files.
+//
+// A Handler serves the latest document pushed with Update; GET requests
+// receive it and POST requests regenerate first. Generate builds a
+// document from any fs.FS:
+//
+//	var h *watchapi.Handler
+//	h = watchapi.NewHandler(func() error {
+//		doc, err := watchapi.Generate(os.DirFS("."), nil, "src")
+//		if err != nil {
+//			return err
+//		}
+//		data, err := json.Marshal(doc)
+//		if err != nil {
+//			return err
+//		}
+//		h.Update(data)
+//		return nil
+//	})
+//	mux.Handle("/api/trees", h)
+package watchapi
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Handler holds the latest tree document and serves it.
+type Handler struct {
+	regenerate func() error
+
+	mu      sync.RWMutex
+	latest  []byte
+	updated time.Time
+
+	runMu   sync.Mutex
+	running *run
+}
+
+// run is an in-flight regeneration that concurrent POSTs wait on.
+type run struct {
+	done chan struct{}
+	err  error
+}
+
+// NewHandler returns a Handler that calls regenerate for POST requests.
+// regenerate is expected to call Update with the new document; it may be
+// nil, in which case POST is not allowed. POSTs arriving while it runs
+// share that run's result rather than starting another.
+func NewHandler(regenerate func() error) *Handler {
+	return &Handler{regenerate: regenerate}
+}
+
+// Update replaces the document served to clients.
+func (h *Handler) Update(doc []byte) {
+	h.mu.Lock()
+	h.latest = doc
+	h.updated = time.Now()
+	h.mu.Unlock()
+}
+
+// ServeHTTP returns the latest document for GET and HEAD, and regenerates
+// before returning it for POST.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		if h.regenerate == nil {
+			http.Error(w, "regeneration is not available", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := h.regenerateOnce(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.RLock()
+	doc, updated := h.latest, h.updated
+	h.mu.RUnlock()
+	if doc == nil {
+		http.Error(w, "trees have not been generated yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	w.Write(doc)
+}
+
+// regenerateOnce calls regenerate, or, if a call is already in progress,
+// waits for it and returns its result, so concurrent requests trigger a
+// single generation.
+func (h *Handler) regenerateOnce() error {
+	h.runMu.Lock()
+	if r := h.running; r != nil {
+		h.runMu.Unlock()
+		<-r.done
+		return r.err
+	}
+	r := &run{done: make(chan struct{})}
+	h.running = r
+	h.runMu.Unlock()
+
+	r.err = h.regenerate()
+
+	h.runMu.Lock()
+	h.running = nil
+	h.runMu.Unlock()
+	close(r.done)
+	return r.err
+}
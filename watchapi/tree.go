@@ -0,0 +1,113 @@
+package watchapi
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"time"
+)
+
+// SchemaVersion is bumped whenever the tree JSON changes incompatibly.
+const SchemaVersion = 1
+
+// Document is the tree JSON, consumed directly by the admin dashboard's
+// file browser:
+//
+//	{
+//	  "version": 1,
+//	  "generator": "watch v1.4.0 (commit …)",
+//	  "generatedAt": "2026-10-16T08:00:00Z",
+//	  "roots": [{
+//	    "directory": "src",
+//	    "git": {"branch": "main", "commit": "1a2b3c4", "dirty": false},
+//	    "tree": {
+//	      "id": "5d41402abc4b2a76", "name": "src", "path": "src",
+//	      "kind": "directory", "size": 5120, "mtime": "…",
+//	      "children": [{
+//	        "id": "…", "name": "page.tsx", "path": "src/app/page.tsx",
+//	        "kind": "file", "size": 2048, "mtime": "…"
+//	      }]
+//	    }
+//	  }]
+//	}
+//
+// Fields are never removed or repurposed within a version; new optional
+// fields may be added.
+type Document struct {
+	Version     int       `json:"version"`
+	Generator   string    `json:"generator"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Roots       []Root    `json:"roots"`
+}
+
+// Root is one configured directory or file and its tree.
+type Root struct {
+	Directory string    `json:"directory"`     // As configured
+	Git       *GitState `json:"git,omitempty"` // Absent outside a git repository
+	Tree      *Node     `json:"tree"`
+	Union     []string  `json:"union,omitempty"` // Roots overlaid, for a union
+	Alias     string    `json:"alias,omitempty"` // Display name from the config
+	Group     string    `json:"group,omitempty"` // Header the root is presented under
+}
+
+// GitState identifies the code state a root was generated from.
+type GitState struct {
+	Branch string `json:"branch"` // "HEAD" when detached
+	Commit string `json:"commit"` // Short SHA
+	Dirty  bool   `json:"dirty"`
+}
+
+// String renders the state for section headers, e.g. "main @ 1a2b3c4, dirty".
+func (g *GitState) String() string {
+	s := g.Branch + " @ " + g.Commit
+	if g.Dirty {
+		s += ", dirty"
+	}
+	return s
+}
+
+// Node is one file or directory.
+type Node struct {
+	ID        string    `json:"id"`   // Stable across generations and unique in a document: derived from root and path
+	Name      string    `json:"name"` // Base name; the configured directory for roots
+	Path      string    `json:"path"` // Slash-separated, starting with the root directory unless it is "."
+	Kind      string    `json:"kind"` // "file" or "directory"
+	Size      int64     `json:"size"` // Bytes; for directories the total of their files
+	ModTime   time.Time `json:"mtime"`
+	Generated bool      `json:"generated,omitempty"` // linguist-generated in .gitattributes
+	Children  []*Node   `json:"children,omitempty"`  // Directories only, sorted by name
+
+	// Entries dropped from this directory by the maxNodes cap.
+	Pruned *Pruned `json:"pruned,omitempty"`
+
+	// Roots an entry of a union comes from, bottom layer first.
+	Origins []string `json:"origins,omitempty"`
+
+	// Description from the config's notes.
+	Note string `json:"note,omitempty"`
+
+	// Labels from the config's tags, sorted.
+	Tags []string `json:"tags,omitempty"`
+
+	// Size and mtime as in the text output; only with a format configured.
+	Display *Display `json:"display,omitempty"`
+}
+
+// Pruned records what a directory lost to the node cap.
+type Pruned struct {
+	Files int `json:"files"`
+	Dirs  int `json:"dirs"`
+}
+
+// Display holds a node's size and mtime formatted for people.
+type Display struct {
+	Size  string `json:"size"`
+	MTime string `json:"mtime"`
+}
+
+// NodeID returns the ID of the node at path under the root directory
+// root. Roots can overlap, "." and "src" both holding "src/index.ts", so
+// the path alone doesn't identify a node.
+func NodeID(root, path string) string {
+	sum := sha1.Sum([]byte(root + "\x00" + path))
+	return hex.EncodeToString(sum[:8])
+}